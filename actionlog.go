@@ -8,6 +8,7 @@ package bond
 import (
 	"context"
 	"log"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -17,14 +18,29 @@ import (
 
 type BalancerRound struct {
 	AverageExecutionTime float64            `bson:"averageExecutionTime"`
+	MaxExecutionTime     int64              `bson:"maxExecutionTime"`
+	Rounds               int                `bson:"rounds"`
 	Time                 primitive.DateTime `bson:"time"`
 	TotalChunksMoved     int                `bson:"totalChunksMoved"`
 	TotalErrors          int                `bson:"totalErrors"`
 }
 
+// RoundError is balancer round errors of a minute with the same error message
+type RoundError struct {
+	Category string             `bson:"category"`
+	ErrMsg   string             `bson:"errmsg"`
+	First    primitive.DateTime `bson:"first"`
+	Last     primitive.DateTime `bson:"last"`
+	Time     primitive.DateTime `bson:"time"`
+	Total    int                `bson:"total"`
+}
+
 type ActionLog struct {
 	BalancerRounds []BalancerRound
-	Stats          struct {
+	RoundErrors    []RoundError
+	// RoundErrorClusters groups round errors by normalized messages, examples are the normalized messages
+	RoundErrorClusters []ErrorCategory
+	Stats              struct {
 		AverageExecutionTime float64 `bson:"averageExecutionTime"`
 		Capped               *bool   `bson:"capped"`
 		MaxExecutionTime     int64   `bson:"maxExecutionTime"`
@@ -34,10 +50,12 @@ type ActionLog struct {
 	}
 
 	client *mongo.Client
+	since  *time.Time
+	until  *time.Time
 }
 
-func NewActionLog(client *mongo.Client) (*ActionLog, error) {
-	actions := ActionLog{client: client}
+func NewActionLog(client *mongo.Client, since *time.Time, until *time.Time) (*ActionLog, error) {
+	actions := ActionLog{client: client, since: since, until: until}
 	var doc bson.M
 	err := client.Database("config").RunCommand(context.Background(), bson.D{{Key: "collStats", Value: "actionlog"}}).Decode(&doc)
 	if err != nil {
@@ -56,7 +74,10 @@ func NewActionLog(client *mongo.Client) (*ActionLog, error) {
 func (ptr *ActionLog) GetStats() error {
 	log.Println("ActionLog.GetStats()")
 	pipeline := bson.A{
-		bson.D{{Key: "$match", Value: bson.D{{Key: "what", Value: "balancer.round"}}}},
+		bson.D{{Key: "$match", Value: bson.D{
+			{Key: "what", Value: "balancer.round"},
+			{Key: "time", Value: GetTimeRangeFilter(ptr.since, ptr.until)},
+		}}},
 		bson.D{
 			{Key: "$group", Value: bson.D{
 				{Key: "_id", Value: primitive.Null{}},
@@ -97,19 +118,21 @@ func (ptr *ActionLog) GetStats() error {
 	return nil
 }
 
+// GetBalancerRounds aggregates balancer rounds by minute, charts bucket them by granularity
 func (ptr *ActionLog) GetBalancerRounds() error {
 	pipeline := bson.A{
 		bson.D{
 			{Key: "$match", Value: bson.D{
 				{Key: "what", Value: "balancer.round"},
+				{Key: "time", Value: GetTimeRangeFilter(ptr.since, ptr.until)},
 				{Key: "details.executionTimeMillis", Value: bson.D{{Key: "$exists", Value: true}}},
 			}},
 		},
 		bson.D{
 			{Key: "$addFields", Value: bson.D{
-				{Key: "hour", Value: bson.D{
+				{Key: "minute", Value: bson.D{
 					{Key: "$dateToString", Value: bson.D{
-						{Key: "format", Value: "%Y-%m-%dT%H:00:00.000Z"},
+						{Key: "format", Value: "%Y-%m-%dT%H:%M:00.000Z"},
 						{Key: "date", Value: "$time"},
 					}},
 				}},
@@ -118,7 +141,7 @@ func (ptr *ActionLog) GetBalancerRounds() error {
 		bson.D{
 			{Key: "$project", Value: bson.D{
 				{Key: "_id", Value: 0},
-				{Key: "hour", Value: 1},
+				{Key: "minute", Value: 1},
 				{Key: "executionTimeMillis", Value: "$details.executionTimeMillis"},
 				{Key: "chunksMoved", Value: "$details.chunksMoved"},
 				{Key: "errorOccured", Value: "$details.errorOccured"},
@@ -127,9 +150,11 @@ func (ptr *ActionLog) GetBalancerRounds() error {
 		bson.D{
 			{Key: "$group", Value: bson.D{
 				{Key: "_id", Value: bson.D{
-					{Key: "hour", Value: "$hour"},
+					{Key: "minute", Value: "$minute"},
 				}},
 				{Key: "averageExecutionTime", Value: bson.D{{Key: "$avg", Value: "$executionTimeMillis"}}},
+				{Key: "maxExecutionTime", Value: bson.D{{Key: "$max", Value: "$executionTimeMillis"}}},
+				{Key: "rounds", Value: bson.D{{Key: "$sum", Value: 1}}},
 				{Key: "totalChunksMoved", Value: bson.D{{Key: "$sum", Value: "$chunksMoved"}}},
 				{Key: "totalErrors", Value: bson.D{
 					{Key: "$sum", Value: bson.D{
@@ -142,8 +167,10 @@ func (ptr *ActionLog) GetBalancerRounds() error {
 		bson.D{
 			{Key: "$project", Value: bson.D{
 				{Key: "_id", Value: 0},
-				{Key: "time", Value: bson.D{{Key: "$toDate", Value: "$_id.hour"}}},
+				{Key: "time", Value: bson.D{{Key: "$toDate", Value: "$_id.minute"}}},
 				{Key: "averageExecutionTime", Value: 1},
+				{Key: "maxExecutionTime", Value: 1},
+				{Key: "rounds", Value: 1},
 				{Key: "totalChunksMoved", Value: 1},
 				{Key: "totalErrors", Value: 1},
 			}},
@@ -169,3 +196,63 @@ func (ptr *ActionLog) GetBalancerRounds() error {
 	defer cursor.Close(ctx)
 	return nil
 }
+
+// GetRoundErrors aggregates balancer round errors by minute and error message, and clusters the messages
+func (ptr *ActionLog) GetRoundErrors() error {
+	log.Println("ActionLog.GetRoundErrors()")
+	pipeline := bson.A{
+		bson.D{
+			{Key: "$match", Value: bson.D{
+				{Key: "what", Value: "balancer.round"},
+				{Key: "time", Value: GetTimeRangeFilter(ptr.since, ptr.until)},
+				{Key: "details.errorOccured", Value: true},
+			}},
+		},
+		bson.D{
+			{Key: "$group", Value: bson.D{
+				{Key: "_id", Value: bson.D{
+					{Key: "minute", Value: bson.D{
+						{Key: "$dateToString", Value: bson.D{
+							{Key: "format", Value: "%Y-%m-%dT%H:%M:00.000Z"},
+							{Key: "date", Value: "$time"},
+						}},
+					}},
+					{Key: "errmsg", Value: "$details.errmsg"},
+				}},
+				{Key: "total", Value: bson.D{{Key: "$sum", Value: 1}}},
+				{Key: "first", Value: bson.D{{Key: "$min", Value: "$time"}}},
+				{Key: "last", Value: bson.D{{Key: "$max", Value: "$time"}}},
+			}},
+		},
+		bson.D{
+			{Key: "$project", Value: bson.D{
+				{Key: "_id", Value: 0},
+				{Key: "time", Value: bson.D{{Key: "$toDate", Value: "$_id.minute"}}},
+				{Key: "errmsg", Value: "$_id.errmsg"},
+				{Key: "total", Value: 1},
+				{Key: "first", Value: 1},
+				{Key: "last", Value: 1},
+			}},
+		},
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "time", Value: 1}}}},
+	}
+	ctx := context.Background()
+	db := ptr.client.Database("config")
+	opts := options.Aggregate().SetAllowDiskUse(true)
+	cursor, err := db.Collection("actionlog").Aggregate(ctx, pipeline, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	clusters := map[string]*ErrorCategory{}
+	for cursor.Next(ctx) {
+		var doc RoundError
+		cursor.Decode(&doc)
+		doc.Category = GetErrorCategory(0, doc.ErrMsg)
+		ptr.RoundErrors = append(ptr.RoundErrors, doc)
+		message := NormalizeErrorMessage(doc.ErrMsg)
+		AddErrorCategory(clusters, doc.Category+"/"+message, doc.Category, message, "", doc.Total, doc.First, doc.Last)
+	}
+	ptr.RoundErrorClusters = GetErrorCategories(clusters)
+	return nil
+}
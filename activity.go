@@ -0,0 +1,88 @@
+/*
+ * Copyright 2023-present Kuei-chun Chen. All rights reserved.
+ * activity.go
+ */
+
+package bond
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	BALANCER_STALE_AFTER = time.Hour // in window time since the last round of a stale balancer
+)
+
+// BalancerActivity is the last balancer round and migration regardless of the analyzed time window
+type BalancerActivity struct {
+	Imbalanced    []string
+	IsIdle        bool
+	IsStale       bool
+	LastMigration *time.Time
+	LastRound     *time.Time
+}
+
+// GetMigrationThreshold returns the difference of chunks between the most and the least loaded shards
+// starting migrations, by number of chunks of a collection before MongoDB 6.0
+func GetMigrationThreshold(chunks int) int {
+	if chunks < 20 {
+		return 2
+	} else if chunks < 80 {
+		return 4
+	}
+	return 8
+}
+
+// getLastEventTime returns time of the latest event of a collection in the config database
+func (ptr *ConfigDB) getLastEventTime(collection string, what string) (*time.Time, error) {
+	var doc struct {
+		Time time.Time `bson:"time"`
+	}
+	opts := options.FindOne().SetSort(bson.D{{Key: "time", Value: -1}}).SetProjection(bson.D{{Key: "time", Value: 1}})
+	err := ptr.client.Database("config").Collection(collection).FindOne(context.Background(),
+		bson.D{{Key: "what", Value: what}}, opts).Decode(&doc)
+	if err != nil {
+		return nil, err
+	}
+	return &doc.Time, nil
+}
+
+// CheckBalancerActivity finds the last balancer round and migration, and flags a stale balancer if no rounds
+// completed within BALANCER_STALE_AFTER of the active window before the last mongos ping, or an idle balancer
+// if rounds ran without moving chunks while collections are imbalanced
+func (ptr *ConfigDB) CheckBalancerActivity() {
+	log.Println("CheckBalancerActivity()")
+	activity := BalancerActivity{}
+	var err error
+	if activity.LastRound, err = ptr.getLastEventTime("actionlog", "balancer.round"); err != nil {
+		log.Println("check last balancer round", err)
+	}
+	if activity.LastMigration, err = ptr.getLastEventTime("changelog", "moveChunk.commit"); err != nil {
+		log.Println("check last migration", err)
+	}
+	for _, coll := range ptr.CollectionsMap {
+		if !coll.NoBalance && coll.Balance.IsImbalanced {
+			activity.Imbalanced = append(activity.Imbalanced, coll.ID)
+		}
+	}
+	sort.Strings(activity.Imbalanced)
+
+	if ptr.LastPing != nil && ptr.Balancer.IsEnabled() && ptr.Actions != nil && ptr.Actions.Stats.Capped != nil {
+		if activity.LastRound == nil {
+			activity.IsStale = true
+		} else if ptr.getInWindowDuration(*activity.LastRound, ptr.LastPing.Time()) >= BALANCER_STALE_AFTER {
+			activity.IsStale = true
+		}
+	}
+	if ptr.Actions != nil && len(ptr.Actions.BalancerRounds) > 0 && ptr.Actions.Stats.TotalChunksMoved == 0 &&
+		len(activity.Imbalanced) > 0 {
+		activity.IsIdle = true
+	}
+	ptr.Activity = activity
+}
@@ -0,0 +1,246 @@
+/*
+ * Copyright 2023-present Kuei-chun Chen. All rights reserved.
+ * analyze.go
+ */
+
+package bond
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/simagix/keyhole/mdb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// QueryAnalyzer is a document of config.queryAnalyzers, query sampling configured by configureQueryAnalyzer since 7.0
+type QueryAnalyzer struct {
+	CollUUID         primitive.Binary `bson:"collUuid"`
+	ID               interface{}      `bson:"_id"`
+	Mode             string           `bson:"mode"`
+	NS               string           `bson:"ns"`
+	SamplesPerSecond float64          `bson:"samplesPerSecond"`
+	StartTime        *time.Time       `bson:"startTime"`
+	StopTime         *time.Time       `bson:"stopTime"`
+}
+
+// ShardKeyAnalysis is the result of analyzeShardKey of a shard key, percentages are of sampled queries
+type ShardKeyAnalysis struct {
+	AvgDocSizeBytes         int64       `bson:"avgDocSizeBytes"`
+	Computed                *time.Time  `bson:"computed"`
+	Error                   string      `bson:"error"`
+	IsUnique                bool        `bson:"isUnique"`
+	Key                     bson.D      `bson:"key"`
+	MonotonicityCoefficient float64     `bson:"monotonicityCoefficient"`
+	MonotonicityType        string      `bson:"monotonicityType"`
+	MostCommonValues        []NameValue `bson:"mostCommonValues"`
+	NumDistinctValues       int64       `bson:"numDistinctValues"`
+	NumDocsTotal            int64       `bson:"numDocsTotal"`
+	NumOrphanDocs           int64       `bson:"numOrphanDocs"`
+	ReadSampleSize          int64       `bson:"readSampleSize"`
+	ReadsMultiShard         float64     `bson:"readsMultiShard"`
+	ReadsScatterGather      float64     `bson:"readsScatterGather"`
+	ReadsSingleShard        float64     `bson:"readsSingleShard"`
+	ShardKeyUpdates         float64     `bson:"shardKeyUpdates"`
+	WriteSampleSize         int64       `bson:"writeSampleSize"`
+	WritesMultiShard        float64     `bson:"writesMultiShard"`
+	WritesScatterGather     float64     `bson:"writesScatterGather"`
+	WritesSingleShard       float64     `bson:"writesSingleShard"`
+}
+
+// GetQueryAnalyzers reads query sampling configurations of collections since 7.0
+func (ptr *ConfigDB) GetQueryAnalyzers() error {
+	log.Println("GetQueryAnalyzers()")
+	ctx := context.Background()
+	cursor, err := ptr.client.Database("config").Collection("queryAnalyzers").Find(ctx, bson.D{})
+	if err != nil {
+		return err
+	}
+	ptr.QueryAnalyzers = map[string]QueryAnalyzer{}
+	for cursor.Next(ctx) {
+		var doc QueryAnalyzer
+		if err = cursor.Decode(&doc); err != nil {
+			continue
+		}
+		if doc.NS == "" {
+			if ns, ok := doc.ID.(string); ok {
+				doc.NS = ns
+			} else {
+				doc.NS = ptr.uuid2NS[string(doc.CollUUID.Data)]
+			}
+		}
+		ptr.QueryAnalyzers[doc.NS] = doc
+	}
+	defer cursor.Close(ctx)
+	return nil
+}
+
+// CanAnalyzeShardKey returns true if analyzeShardKey is available, since 7.0 via a mongos
+func (ptr *ConfigDB) CanAnalyzeShardKey() bool {
+	return ptr.isAtLeast(7.0) && ptr.clusterType == mdb.Sharded
+}
+
+// CompareShardKeys analyzes the current shard key of a collection and an optional candidate key in JSON, errors
+// are kept in the analyses. Analyses are cached by namespaces and keys, analyzeShardKey samples documents and runs
+// again only after ClearShardKeyAnalyses.
+func (ptr *ConfigDB) CompareShardKeys(ns string, candidate string) (*ShardKeyAnalysis, *ShardKeyAnalysis) {
+	analyze := func(key bson.D, err error) *ShardKeyAnalysis {
+		if err != nil {
+			return &ShardKeyAnalysis{Error: err.Error(), Key: key}
+		}
+		name := ns + " " + Stringify(key)
+		if ptr.analyses != nil {
+			if cached, ok := ptr.analyses.Load(name); ok {
+				return cached.(*ShardKeyAnalysis)
+			}
+		}
+		analysis, err := ptr.AnalyzeShardKey(ns, key)
+		if err != nil {
+			return &ShardKeyAnalysis{Error: err.Error(), Key: key}
+		}
+		if ptr.analyses != nil {
+			ptr.analyses.Store(name, analysis)
+		}
+		return analysis
+	}
+	coll, _ := ptr.getCollection(ns)
+	ns = coll.GetName() // time-series collections are analyzed on user-facing fields
+	current := analyze(coll.GetUserKey(), nil)
+	if strings.TrimSpace(candidate) == "" {
+		return current, nil
+	}
+	return current, analyze(ParseShardKey(candidate))
+}
+
+// ClearShardKeyAnalyses removes cached analyses of a collection, to run analyzeShardKey again
+func (ptr *ConfigDB) ClearShardKeyAnalyses(ns string) {
+	if ptr.analyses == nil {
+		return
+	}
+	coll, _ := ptr.getCollection(ns)
+	prefix := coll.GetName() + " "
+	ptr.analyses.Range(func(key, value interface{}) bool {
+		if strings.HasPrefix(key.(string), prefix) {
+			ptr.analyses.Delete(key)
+		}
+		return true
+	})
+}
+
+// AnalyzeShardKey runs analyzeShardKey via a mongos, it samples documents of the collection. Read and write
+// distributions are from queries sampled by configureQueryAnalyzer.
+func (ptr *ConfigDB) AnalyzeShardKey(ns string, key bson.D) (*ShardKeyAnalysis, error) {
+	log.Println("AnalyzeShardKey()", ns, Stringify(key))
+	if !ptr.CanAnalyzeShardKey() {
+		return nil, errors.New("analyzeShardKey requires MongoDB 7.0 or later via a mongos")
+	} else if len(key) == 0 {
+		return nil, errors.New("shard key is required")
+	}
+	var doc struct {
+		KeyCharacteristics struct {
+			AvgDocSizeBytes  int64 `bson:"avgDocSizeBytes"`
+			IsUnique         bool  `bson:"isUnique"`
+			MostCommonValues []struct {
+				Frequency int    `bson:"frequency"`
+				Value     bson.D `bson:"value"`
+			} `bson:"mostCommonValues"`
+			Monotonicity struct {
+				RecordIDCorrelationCoefficient float64 `bson:"recordIdCorrelationCoefficient"`
+				Type                           string  `bson:"type"`
+			} `bson:"monotonicity"`
+			NumDistinctValues int64 `bson:"numDistinctValues"`
+			NumDocsTotal      int64 `bson:"numDocsTotal"`
+			NumOrphanDocs     int64 `bson:"numOrphanDocs"`
+		} `bson:"keyCharacteristics"`
+		ReadDistribution struct {
+			PercentageOfMultiShardReads    float64 `bson:"percentageOfMultiShardReads"`
+			PercentageOfScatterGatherReads float64 `bson:"percentageOfScatterGatherReads"`
+			PercentageOfSingleShardReads   float64 `bson:"percentageOfSingleShardReads"`
+			SampleSize                     struct {
+				Total int64 `bson:"total"`
+			} `bson:"sampleSize"`
+		} `bson:"readDistribution"`
+		WriteDistribution struct {
+			PercentageOfMultiShardWrites    float64 `bson:"percentageOfMultiShardWrites"`
+			PercentageOfScatterGatherWrites float64 `bson:"percentageOfScatterGatherWrites"`
+			PercentageOfShardKeyUpdates     float64 `bson:"percentageOfShardKeyUpdates"`
+			PercentageOfSingleShardWrites   float64 `bson:"percentageOfSingleShardWrites"`
+			SampleSize                      struct {
+				Total int64 `bson:"total"`
+			} `bson:"sampleSize"`
+		} `bson:"writeDistribution"`
+	}
+	err := ptr.client.Database("admin").RunCommand(context.Background(), bson.D{{Key: "analyzeShardKey", Value: ns},
+		{Key: "key", Value: key}, {Key: "keyCharacteristics", Value: true}, {Key: "readWriteDistribution", Value: true}}).Decode(&doc)
+	if err != nil {
+		return nil, err
+	}
+	chars, reads, writes := doc.KeyCharacteristics, doc.ReadDistribution, doc.WriteDistribution
+	computed := time.Now()
+	analysis := ShardKeyAnalysis{AvgDocSizeBytes: chars.AvgDocSizeBytes, Computed: &computed, IsUnique: chars.IsUnique, Key: key,
+		MonotonicityCoefficient: chars.Monotonicity.RecordIDCorrelationCoefficient, MonotonicityType: chars.Monotonicity.Type,
+		NumDistinctValues: chars.NumDistinctValues, NumDocsTotal: chars.NumDocsTotal, NumOrphanDocs: chars.NumOrphanDocs,
+		ReadSampleSize: reads.SampleSize.Total, ReadsMultiShard: reads.PercentageOfMultiShardReads,
+		ReadsScatterGather: reads.PercentageOfScatterGatherReads, ReadsSingleShard: reads.PercentageOfSingleShardReads,
+		ShardKeyUpdates: writes.PercentageOfShardKeyUpdates, WriteSampleSize: writes.SampleSize.Total,
+		WritesMultiShard: writes.PercentageOfMultiShardWrites, WritesScatterGather: writes.PercentageOfScatterGatherWrites,
+		WritesSingleShard: writes.PercentageOfSingleShardWrites}
+	for _, mcv := range chars.MostCommonValues {
+		analysis.MostCommonValues = append(analysis.MostCommonValues, NameValue{Stringify(mcv.Value), mcv.Frequency})
+	}
+	return &analysis, nil
+}
+
+// ParseShardKey parses a shard key in JSON, e.g. {"region": 1, "_id": 1}
+func ParseShardKey(str string) (bson.D, error) {
+	var key bson.D
+	err := bson.UnmarshalExtJSON([]byte(str), false, &key)
+	return key, err
+}
+
+const (
+	// query sampling and analyzeShardKey of a collection, runs only if requested
+	AnalyzeShardKeyHTML = `
+	<div style='float: left; clear: left;'>
+	<table><caption>Shard Key Analysis</caption><tr><th>Metric</th><th>Current Key</th>{{if .Candidate}}<th>Candidate Key</th>{{end}}
+{{if not .CanAnalyze}}
+		<tr><td align='left' class='rowtitle'>analyzeShardKey</td><td align='left' class='break'>requires MongoDB 7.0 or later via a mongos</td></tr>
+{{else}}
+		<tr><td align='left' class='rowtitle'>Query Sampling</td><td align='left' class='break' colspan='2'>
+		{{if .QueryAnalyzer}}
+			{{.QueryAnalyzer.Mode}}, {{.QueryAnalyzer.SamplesPerSecond}} samples/second since {{ISOTime .QueryAnalyzer.StartTime}}
+		{{else}}
+			not configured, to sample queries run
+			<code>db.adminCommand({ configureQueryAnalyzer: "{{.Collection.GetName}}", mode: "full", samplesPerSecond: 10 })</code>
+		{{end}}</td></tr>
+		<tr><td align='left' class='rowtitle'>Candidate Key</td><td align='left' class='break' colspan='2'>
+			<input type='text' id='candidateKey' size='40' placeholder='{"field": 1, "_id": 1}' value='{{.CandidateKey}}'/>
+			<button class='btn' title='analyzeShardKey samples documents of the collection'
+				onClick="javascript:loadData('{{pathURL "/bond/collections/" .Collection.ID}}?analyze=1&key=' + encodeURIComponent(document.getElementById('candidateKey').value)); return false;">
+				<i class='fa fa-flask'> Analyze</i></button></td></tr>
+	{{if .Analysis}}
+		{{$current := .Analysis}}{{$candidate := .Candidate}}
+		<tr><td align='left' class='rowtitle'>Shard Key</td><td align='left' class='break'>{{stringify $current.Key}}</td>{{if $candidate}}<td align='left' class='break'>{{stringify $candidate.Key}}</td>{{end}}</tr>
+		<tr><td align='left' class='rowtitle'>Analyzed at <a href='{{pathURL "/bond/collections/" .Collection.ID}}?analyze=1&key={{.CandidateKey}}&refresh=1'
+			title='analyze again, analyzeShardKey samples documents of the collection'><i class='fa fa-refresh'></i></a></td>
+			<td align='left' class='break'>{{ISOTime $current.Computed}}</td>{{if $candidate}}<td align='left' class='break'>{{ISOTime $candidate.Computed}}</td>{{end}}</tr>
+		{{if or $current.Error (and $candidate $candidate.Error)}}
+		<tr><td align='left' class='rowtitle'>Error</td><td align='left' class='break'><span style='color: red'>{{$current.Error}}</span></td>{{if $candidate}}<td align='left' class='break'><span style='color: red'>{{$candidate.Error}}</span></td>{{end}}</tr>
+		{{end}}
+		<tr><td align='left' class='rowtitle'>Documents (Orphans)</td><td align='right' class='break'>{{numPrinter $current.NumDocsTotal}} ({{numPrinter $current.NumOrphanDocs}})</td>{{if $candidate}}<td align='right' class='break'>{{numPrinter $candidate.NumDocsTotal}} ({{numPrinter $candidate.NumOrphanDocs}})</td>{{end}}</tr>
+		<tr><td align='left' class='rowtitle'>Cardinality</td><td align='right' class='break'>{{numPrinter $current.NumDistinctValues}}{{if $current.IsUnique}} unique{{end}}</td>{{if $candidate}}<td align='right' class='break'>{{numPrinter $candidate.NumDistinctValues}}{{if $candidate.IsUnique}} unique{{end}}</td>{{end}}</tr>
+		<tr><td align='left' class='rowtitle'>Most Common Values</td><td align='left' class='break'>{{range $i, $v := $current.MostCommonValues}}{{if $i}}<br/>{{end}}{{$v.Name}}: {{numPrinter $v.Value}}{{end}}</td>{{if $candidate}}<td align='left' class='break'>{{range $i, $v := $candidate.MostCommonValues}}{{if $i}}<br/>{{end}}{{$v.Name}}: {{numPrinter $v.Value}}{{end}}</td>{{end}}</tr>
+		<tr><td align='left' class='rowtitle'>Monotonicity</td><td align='right' class='break'>{{$current.MonotonicityType}} ({{printf "%.2f" $current.MonotonicityCoefficient}})</td>{{if $candidate}}<td align='right' class='break'>{{$candidate.MonotonicityType}} ({{printf "%.2f" $candidate.MonotonicityCoefficient}})</td>{{end}}</tr>
+		<tr><td align='left' class='rowtitle'>Sampled Reads</td><td align='right' class='break'>{{numPrinter $current.ReadSampleSize}}</td>{{if $candidate}}<td align='right' class='break'>{{numPrinter $candidate.ReadSampleSize}}</td>{{end}}</tr>
+		<tr><td align='left' class='rowtitle'>Single/Multi Shard/Scatter Gather Reads</td><td align='right' class='break'>{{printf "%.1f%% / %.1f%% / %.1f%%" $current.ReadsSingleShard $current.ReadsMultiShard $current.ReadsScatterGather}}</td>{{if $candidate}}<td align='right' class='break'>{{printf "%.1f%% / %.1f%% / %.1f%%" $candidate.ReadsSingleShard $candidate.ReadsMultiShard $candidate.ReadsScatterGather}}</td>{{end}}</tr>
+		<tr><td align='left' class='rowtitle'>Sampled Writes</td><td align='right' class='break'>{{numPrinter $current.WriteSampleSize}}</td>{{if $candidate}}<td align='right' class='break'>{{numPrinter $candidate.WriteSampleSize}}</td>{{end}}</tr>
+		<tr><td align='left' class='rowtitle'>Single/Multi Shard/Scatter Gather Writes</td><td align='right' class='break'>{{printf "%.1f%% / %.1f%% / %.1f%%" $current.WritesSingleShard $current.WritesMultiShard $current.WritesScatterGather}}</td>{{if $candidate}}<td align='right' class='break'>{{printf "%.1f%% / %.1f%% / %.1f%%" $candidate.WritesSingleShard $candidate.WritesMultiShard $candidate.WritesScatterGather}}</td>{{end}}</tr>
+		<tr><td align='left' class='rowtitle'>Shard Key Updates</td><td align='right' class='break'>{{printf "%.1f%%" $current.ShardKeyUpdates}}</td>{{if $candidate}}<td align='right' class='break'>{{printf "%.1f%%" $candidate.ShardKeyUpdates}}</td>{{end}}</tr>
+	{{end}}
+{{end}}
+	</table></div>`
+)
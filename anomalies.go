@@ -0,0 +1,185 @@
+/*
+ * Copyright 2023-present Kuei-chun Chen. All rights reserved.
+ * anomalies.go
+ */
+
+package bond
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/simagix/gox"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	ANOMALY_OUTSIDE_WINDOW = "Outside Active Window"
+	ANOMALY_SPIKE          = "Round Time Spike"
+	ANOMALY_STALLED        = "Stalled Balancer"
+
+	BASELINE_MINUTES   = 60               // rolling baseline of minutes having rounds
+	BASELINE_MIN_SIZE  = 10               // minimum minutes of a baseline
+	SPIKE_MIN_INCREASE = 1000             // minimum increase in milliseconds of a spike
+	STALL_GAP          = 30 * time.Minute // minimum in window time without rounds of a stalled balancer
+)
+
+// BalancerSettings is the balancer document of config.settings, active window times are in the local time zone of
+// the config server primary
+type BalancerSettings struct {
+	ActiveWindow *struct {
+		Start string `bson:"start"`
+		Stop  string `bson:"stop"`
+	} `bson:"activeWindow"`
+	Mode    *string `bson:"mode"`
+	Stopped *bool   `bson:"stopped"`
+}
+
+// BalancerAnomaly is a time range of unusual balancer rounds
+type BalancerAnomaly struct {
+	Detail string             `bson:"detail"`
+	End    primitive.DateTime `bson:"end"`
+	Kind   string             `bson:"kind"`
+	Rounds int                `bson:"rounds"`
+	Start  primitive.DateTime `bson:"start"`
+}
+
+// IsEnabled returns false if the balancer is stopped or turned off
+func (ptr *BalancerSettings) IsEnabled() bool {
+	if ptr.Stopped != nil && *ptr.Stopped {
+		return false
+	}
+	return ptr.Mode == nil || *ptr.Mode != "off"
+}
+
+// IsInWindow returns true if no active window is set or t is within the active window, evaluated in the time
+// zone of the config server primary
+func (ptr *BalancerSettings) IsInWindow(t time.Time, loc *time.Location) bool {
+	if ptr.ActiveWindow == nil {
+		return true
+	}
+	start, err := getMinuteOfDay(ptr.ActiveWindow.Start)
+	if err != nil {
+		return true
+	}
+	stop, err := getMinuteOfDay(ptr.ActiveWindow.Stop)
+	if err != nil {
+		return true
+	}
+	t = t.In(loc)
+	minute := t.Hour()*60 + t.Minute()
+	if start <= stop {
+		return minute >= start && minute < stop
+	}
+	return minute >= start || minute < stop
+}
+
+// getMinuteOfDay returns minutes since midnight of HH:MM
+func getMinuteOfDay(hhmm string) (int, error) {
+	var hour, minute int
+	if _, err := fmt.Sscanf(strings.TrimSpace(hhmm), "%d:%d", &hour, &minute); err != nil {
+		return 0, err
+	}
+	return hour*60 + minute, nil
+}
+
+// GetBalancerAnomalies detects round time spikes against a rolling baseline, rounds outside the active window,
+// and periods within the active window without rounds while the balancer is enabled
+func (ptr *ConfigDB) GetBalancerAnomalies() {
+	ptr.BalancerAnomalies = nil
+	if ptr.Actions == nil || len(ptr.Actions.BalancerRounds) == 0 {
+		return
+	}
+	rounds := ptr.Actions.BalancerRounds
+	loc := ptr.GetWindowLocation()
+	add := func(kind string, start time.Time, end time.Time, rounds int, detail string) {
+		// extend the last range of the same kind if they are adjacent
+		for i := len(ptr.BalancerAnomalies) - 1; i >= 0; i-- {
+			last := &ptr.BalancerAnomalies[i]
+			if last.Kind != kind {
+				continue
+			}
+			if !start.After(last.End.Time().Add(10 * time.Minute)) {
+				if end.After(last.End.Time()) {
+					last.End = primitive.NewDateTimeFromTime(end)
+				}
+				last.Rounds += rounds
+				return
+			}
+			break
+		}
+		ptr.BalancerAnomalies = append(ptr.BalancerAnomalies, BalancerAnomaly{Detail: detail,
+			End: primitive.NewDateTimeFromTime(end), Kind: kind, Rounds: rounds, Start: primitive.NewDateTimeFromTime(start)})
+	}
+
+	for i, round := range rounds {
+		t := round.Time.Time()
+		// spikes against the preceding minutes
+		if i >= BASELINE_MIN_SIZE {
+			var sum, squares float64
+			baseline := rounds[int(math.Max(0, float64(i-BASELINE_MINUTES))):i]
+			for _, r := range baseline {
+				sum += r.AverageExecutionTime
+				squares += r.AverageExecutionTime * r.AverageExecutionTime
+			}
+			mean := sum / float64(len(baseline))
+			stddev := math.Sqrt(math.Max(0, squares/float64(len(baseline))-mean*mean))
+			if round.AverageExecutionTime > mean+3*stddev && round.AverageExecutionTime > 2*mean &&
+				round.AverageExecutionTime-mean >= SPIKE_MIN_INCREASE {
+				add(ANOMALY_SPIKE, t, t.Add(time.Minute), round.Rounds,
+					fmt.Sprintf("%.0f ms against a baseline of %.0f ms", round.AverageExecutionTime, mean))
+			}
+		}
+		// rounds started or ended outside the active window
+		started := t.Add(-time.Duration(round.MaxExecutionTime) * time.Millisecond)
+		if !ptr.Balancer.IsInWindow(t, loc) || !ptr.Balancer.IsInWindow(started, loc) {
+			add(ANOMALY_OUTSIDE_WINDOW, t, t.Add(time.Minute), round.Rounds,
+				fmt.Sprintf("active window %v to %v %v", ptr.Balancer.ActiveWindow.Start, ptr.Balancer.ActiveWindow.Stop, loc))
+		}
+		// gaps without rounds
+		if i > 0 && ptr.Balancer.IsEnabled() {
+			from := rounds[i-1].Time.Time().Add(time.Minute)
+			if gap := ptr.getInWindowDuration(from, t); gap >= STALL_GAP {
+				add(ANOMALY_STALLED, from, t, 0, fmt.Sprintf("no rounds for %v within the active window", gox.GetDurationFromSeconds(gap.Seconds())))
+			}
+		}
+	}
+	sort.SliceStable(ptr.BalancerAnomalies, func(i, j int) bool {
+		return ptr.BalancerAnomalies[i].Start < ptr.BalancerAnomalies[j].Start
+	})
+}
+
+// getInWindowDuration returns duration between from and to within the balancer active window
+func (ptr *ConfigDB) getInWindowDuration(from time.Time, to time.Time) time.Duration {
+	if ptr.Balancer.ActiveWindow == nil {
+		return to.Sub(from)
+	}
+	loc := ptr.GetWindowLocation()
+	var duration time.Duration
+	for t := from; t.Before(to); t = t.Add(time.Minute) {
+		if ptr.Balancer.IsInWindow(t, loc) {
+			duration += time.Minute
+		}
+	}
+	return duration
+}
+
+// GetBalancerAnomaliesPage returns a page of balancer anomalies
+func GetBalancerAnomaliesPage(r *http.Request, anomalies []BalancerAnomaly) ([]BalancerAnomaly, *TableQuery) {
+	q := NewTableQuery(r, "anomalies", "start", true)
+	docs := []BalancerAnomaly{}
+	for _, i := range q.Apply(len(anomalies), func(i int) string { return anomalies[i].Kind },
+		map[string]func(int) interface{}{
+			"kind":   func(i int) interface{} { return anomalies[i].Kind },
+			"start":  func(i int) interface{} { return int64(anomalies[i].Start) },
+			"end":    func(i int) interface{} { return int64(anomalies[i].End) },
+			"rounds": func(i int) interface{} { return anomalies[i].Rounds },
+		}) {
+		docs = append(docs, anomalies[i])
+	}
+	return docs, q
+}
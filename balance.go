@@ -0,0 +1,249 @@
+/*
+ * Copyright 2023-present Kuei-chun Chen. All rights reserved.
+ * balance.go
+ */
+
+package bond
+
+import (
+	"context"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/simagix/keyhole/mdb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	DEFAULT_CHUNK_SIZE_MB = 128
+)
+
+// CollectionBalance measures chunk distribution of a collection among shards. Score is the percentage of chunks
+// that don't need to move for an even distribution, and size skew is the largest shard data size over the average.
+// Size difference and threshold are set if the balancer distributes data size, since 6.0.
+type CollectionBalance struct {
+	CV             float64          `bson:"cv"`
+	Difference     int              `bson:"difference"`
+	IsImbalanced   bool             `bson:"isImbalanced"`
+	Score          float64          `bson:"score"`
+	ShardSizes     map[string]int64 `bson:"shardSizes"`
+	SizeDifference int64            `bson:"sizeDifference"`
+	SizeSkew       float64          `bson:"sizeSkew"`
+	SizeThreshold  int64            `bson:"sizeThreshold"`
+	Threshold      int              `bson:"threshold"`
+}
+
+// isAtLeast returns true if the major version is at least the given version
+func (ptr *ConfigDB) isAtLeast(version float64) bool {
+	major, err := strconv.ParseFloat(ptr.MajorVersion, 64)
+	return err == nil && major >= version
+}
+
+// isDataSizeBalanced returns true if the balancer distributes data size instead of number of chunks, since 6.0
+func (ptr *ConfigDB) isDataSizeBalanced() bool {
+	return ptr.isAtLeast(6.0)
+}
+
+// GetBalanceInfo evaluates chunk distributions of collections and the cluster balance score. Data sizes of
+// shards are from collStats if connected to a mongos. Collections are imbalanced if the chunks difference
+// between the most and the least loaded shards reaches the migration threshold, or since 6.0, if the data size
+// difference reaches 3 times the chunk size.
+func (ptr *ConfigDB) GetBalanceInfo() error {
+	log.Println("GetBalanceInfo()")
+	ctx := context.Background()
+	var setting struct {
+		Value int `bson:"value"`
+	}
+	if err := ptr.client.Database("config").Collection("settings").FindOne(ctx,
+		bson.D{{Key: "_id", Value: "chunksize"}}).Decode(&setting); err == nil && setting.Value > 0 {
+		ptr.ChunkSize = setting.Value
+	} else {
+		ptr.ChunkSize = DEFAULT_CHUNK_SIZE_MB
+	}
+
+	var total, moves int
+	for ns, coll := range ptr.CollectionsMap {
+		if ptr.clusterType == mdb.Sharded {
+			if sizes, err := ptr.getShardSizes(ns); err != nil {
+				log.Println("collStats", ns, "error", err)
+			} else {
+				coll.Balance.ShardSizes = sizes
+			}
+		}
+		ptr.EvaluateBalance(&coll)
+		ptr.CollectionsMap[ns] = coll
+		if coll.Chunks > 0 {
+			total += coll.Chunks
+			moves += int(math.Round((100 - coll.Balance.Score) * float64(coll.Chunks) / 100))
+		}
+	}
+	ptr.BalanceScore = 100
+	if total > 0 {
+		ptr.BalanceScore = 100 * float64(total-moves) / float64(total)
+	}
+	return nil
+}
+
+// EvaluateBalance evaluates chunk distribution of a collection among shards. Chunks are evenly distributed among
+// shards not draining, and chunks on draining shards all move. A collection with zones is distributed among shards
+// of its zones and not flagged imbalanced, the balancer moves its chunks by zone ranges, see balancerCollectionStatus.
+func (ptr *ConfigDB) EvaluateBalance(coll *ConfigCollection) {
+	balance := &coll.Balance
+	shards := ptr.getBalanceShards(coll)
+	n := len(shards)
+	if n == 0 || coll.Chunks == 0 {
+		balance.Score = 100
+		return
+	}
+	ideal := int(math.Ceil(float64(coll.Chunks) / float64(n)))
+	min, max, moves := coll.Chunks, 0, 0
+	var sum, squares float64
+	for name, chunks := range coll.shards {
+		if !shards[name] {
+			moves += chunks
+		}
+	}
+	for name := range shards {
+		chunks := coll.shards[name]
+		if chunks < min {
+			min = chunks
+		}
+		if chunks > max {
+			max = chunks
+		}
+		if chunks > ideal {
+			moves += chunks - ideal
+		}
+		sum += float64(chunks)
+		squares += float64(chunks * chunks)
+	}
+	mean := sum / float64(n)
+	if mean > 0 {
+		balance.CV = math.Sqrt(math.Max(0, squares/float64(n)-mean*mean)) / mean
+	}
+	balance.Difference = max - min
+	balance.Score = math.Max(0, 100*float64(coll.Chunks-moves)/float64(coll.Chunks))
+	balance.Threshold = GetMigrationThreshold(coll.Chunks)
+	balance.IsImbalanced = balance.Difference >= balance.Threshold
+
+	if len(balance.ShardSizes) > 0 {
+		var minSize, maxSize, totalSize int64 = math.MaxInt64, 0, 0
+		for name := range shards {
+			size := balance.ShardSizes[name]
+			if size < minSize {
+				minSize = size
+			}
+			if size > maxSize {
+				maxSize = size
+			}
+			totalSize += size
+		}
+		if totalSize > 0 {
+			balance.SizeSkew = float64(maxSize) / (float64(totalSize) / float64(n))
+		}
+		if ptr.isDataSizeBalanced() {
+			balance.SizeDifference = maxSize - minSize
+			balance.SizeThreshold = 3 * int64(ptr.getChunkSize(coll)) * 1024 * 1024
+			balance.IsImbalanced = balance.SizeDifference >= balance.SizeThreshold
+		}
+	}
+	if len(coll.Zones) > 0 {
+		balance.IsImbalanced = false
+	}
+}
+
+// getBalanceShards returns shards a collection is distributed among, shards not draining and, if the collection
+// has zones, of its zones
+func (ptr *ConfigDB) getBalanceShards(coll *ConfigCollection) map[string]bool {
+	zones := map[string]bool{}
+	for _, zone := range coll.Zones {
+		zones[zone] = true
+	}
+	shards, zoned := map[string]bool{}, map[string]bool{}
+	for name, shard := range ptr.ShardsMap {
+		if shard.IsDraining() {
+			continue
+		}
+		shards[name] = true
+		for _, tag := range shard.Tags {
+			if zones[tag] {
+				zoned[name] = true
+			}
+		}
+	}
+	if len(zoned) > 0 {
+		return zoned
+	}
+	return shards
+}
+
+// GetZones reads zones of collections from zone ranges in config.tags
+func (ptr *ConfigDB) GetZones() error {
+	log.Println("GetZones()")
+	ctx := context.Background()
+	opts := options.Find().SetProjection(bson.D{{Key: "ns", Value: 1}, {Key: "tag", Value: 1}})
+	cursor, err := ptr.client.Database("config").Collection("tags").Find(ctx, bson.D{}, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var doc struct {
+			NS  string `bson:"ns"`
+			Tag string `bson:"tag"`
+		}
+		if err = cursor.Decode(&doc); err != nil {
+			continue
+		}
+		coll, ok := ptr.CollectionsMap[doc.NS]
+		if !ok {
+			continue
+		}
+		found := false
+		for _, zone := range coll.Zones {
+			found = found || zone == doc.Tag
+		}
+		if !found {
+			coll.Zones = append(coll.Zones, doc.Tag)
+			ptr.CollectionsMap[doc.NS] = coll
+		}
+	}
+	return cursor.Err()
+}
+
+// getChunkSize returns chunk size in MB of a collection, configureCollectionBalancing sets a per-collection
+// chunk size since 5.3
+func (ptr *ConfigDB) getChunkSize(coll *ConfigCollection) int {
+	if coll != nil && coll.MaxChunkSizeBytes >= 1024*1024 {
+		return int(coll.MaxChunkSizeBytes / (1024 * 1024))
+	} else if ptr.ChunkSize > 0 {
+		return ptr.ChunkSize
+	}
+	return DEFAULT_CHUNK_SIZE_MB
+}
+
+// getShardSizes returns data sizes of a sharded collection by shards from collStats
+func (ptr *ConfigDB) getShardSizes(ns string) (map[string]int64, error) {
+	toks := strings.SplitN(ns, ".", 2)
+	if len(toks) < 2 {
+		return nil, nil
+	}
+	var doc struct {
+		Shards map[string]struct {
+			Size int64 `bson:"size"`
+		} `bson:"shards"`
+	}
+	err := ptr.client.Database(toks[0]).RunCommand(context.Background(),
+		bson.D{{Key: "collStats", Value: toks[1]}}).Decode(&doc)
+	if err != nil {
+		return nil, err
+	}
+	sizes := map[string]int64{}
+	for name, stats := range doc.Shards {
+		sizes[name] = stats.Size
+	}
+	return sizes, nil
+}
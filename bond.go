@@ -23,9 +23,14 @@ const (
 func Run(fullVersion string) {
 	mongover := flag.String("mongo", "", "MongoDB version, required if connects to config db")
 	port := flag.Int("port", 3618, "web server port number")
+	since := flag.String("since", "", "analyze logs since, e.g. 2023-11-01T02:00")
+	splits := flag.Int("splits", SPLIT_BURST_THRESHOLD, "split storm threshold of a collection in 10 minutes, 0 to disable")
+	tz := flag.String("tz", "UTC", "time zone of time window and charts, e.g. America/New_York")
+	until := flag.String("until", "", "analyze logs until, e.g. 2023-11-01T04:00")
 	ver := flag.Bool("version", false, "print version number")
 	verbose := flag.Bool("v", false, "turn on verbose")
 	web := flag.Bool("web", false, "starts a web server")
+	windowTz := flag.String("windowTz", "", "time zone of the config server primary evaluating the balancer active window, defaults to -tz")
 
 	flag.Parse()
 	flagset := make(map[string]bool)
@@ -39,10 +44,34 @@ func Run(fullVersion string) {
 	}
 
 	uri := flag.Arg(0)
+	simulate := flag.NewFlagSet("simulate", flag.ExitOnError)
+	add := simulate.Int("add", 0, "number of shards to add")
+	drain := simulate.String("drain", "", "name of the shard to drain")
+	if uri == "simulate" { // bond simulate [-add N] [-drain shard] <uri>
+		simulate.Parse(flag.Args()[1:])
+		if uri = simulate.Arg(0); uri == "" {
+			log.Fatal("connection string is required")
+		}
+	}
 	cfg, err := NewConfigDB(uri, *mongover, *verbose)
 	if err != nil {
 		log.Fatal(err)
 	}
+	cfg.SplitThreshold = *splits
+	if err = cfg.SetTimeZone(*tz); err != nil {
+		log.Fatal(err)
+	}
+	if *windowTz != "" {
+		if err = cfg.SetWindowTimeZone(*windowTz); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if cfg.Since, err = ParseTime(*since, cfg.GetLocation()); err != nil {
+		log.Fatal(err)
+	}
+	if cfg.Until, err = ParseTime(*until, cfg.GetLocation()); err != nil {
+		log.Fatal(err)
+	}
 	if err = cfg.GetShardingInfo(); err != nil {
 		log.Fatal(err)
 	}
@@ -56,6 +85,14 @@ func Run(fullVersion string) {
 	if *verbose {
 		log.Println(StringifyIndent(cfg))
 	}
+	if simulate.Parsed() {
+		simulation, err := cfg.Simulate(*add, *drain)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(simulation)
+		return
+	}
 
 	if !*web {
 		if len(flag.Args()) == 0 {
@@ -66,9 +103,16 @@ func Run(fullVersion string) {
 
 	router := httprouter.New()
 	router.GET("/", InfoHandler)
+	router.GET("/api/bond/v1.0/charts/:attr", ChartDataHandler)
 	router.GET("/api/bond/v1.0/data/:attr", DataHandler)
 	router.GET("/favicon.ico", FaviconHandler)
 	router.GET("/bond/info", InfoHandler)
+	router.GET("/bond/databases/:db", DatabaseHandler)
+	router.GET("/bond/collections/:ns", CollectionHandler)
+	router.GET("/bond/events", EventsHandler)
+	router.GET("/bond/jumbo", JumboHandler)
+	router.GET("/bond/merges", MergesHandler)
+	router.GET("/bond/simulate", SimulateHandler)
 
 	router.GET("/bond/charts/:attr", ChartsHandler)
 	router.GET("/bond/chart/shards/:shard", ShardChartHandler)
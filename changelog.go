@@ -7,6 +7,8 @@ package bond
 
 import (
 	"context"
+	"net/http"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -15,9 +17,15 @@ import (
 )
 
 type ChunkMoveError struct {
-	From  string `bson:"from"`
-	To    string `bson:"to"`
-	Total int    `bson:"total"`
+	Category string             `bson:"category"`
+	Code     int                `bson:"code"`
+	ErrMsg   string             `bson:"errmsg"`
+	First    primitive.DateTime `bson:"first"`
+	From     string             `bson:"from"`
+	Last     primitive.DateTime `bson:"last"`
+	NS       string             `bson:"ns"`
+	To       string             `bson:"to"`
+	Total    int                `bson:"total"`
 }
 
 type Split struct {
@@ -26,8 +34,14 @@ type Split struct {
 }
 
 type ChangeLog struct {
-	ChunkMoveErrors []ChunkMoveError `bson:"chunkMoveErrors"`
-	Splits          []Split          `bson:"splits"`
+	ChangeEvents             []ChangeEvent    `bson:"changeEvents"`
+	ChunkDeltas              []ChunkDelta     `bson:"chunkDeltas"`
+	ChunkMoveErrors          []ChunkMoveError `bson:"chunkMoveErrors"`
+	ChunkMoveErrorCategories []ErrorCategory  `bson:"chunkMoveErrorCategories"`
+	Migrations               []Migration      `bson:"migrations"`
+	MigrationStats           MigrationStats   `bson:"migrationStats"`
+	NamespaceSplits          []NamespaceSplit `bson:"namespaceSplits"`
+	Splits                   []Split          `bson:"splits"`
 
 	Stats struct {
 		Capped               *bool `bson:"capped"`
@@ -36,10 +50,12 @@ type ChangeLog struct {
 		TotalSplits          int   `bson:"totalSplits"`
 	} `bson:"stats"`
 	client *mongo.Client
+	since  *time.Time
+	until  *time.Time
 }
 
-func NewChangeLog(client *mongo.Client) (*ChangeLog, error) {
-	changes := ChangeLog{client: client}
+func NewChangeLog(client *mongo.Client, since *time.Time, until *time.Time) (*ChangeLog, error) {
+	changes := ChangeLog{client: client, since: since, until: until}
 	var doc bson.M
 	client.Database("config").RunCommand(context.Background(), bson.D{{Key: "collStats", Value: "changelog"}}).Decode(&doc)
 	if doc["capped"] != nil {
@@ -52,6 +68,7 @@ func NewChangeLog(client *mongo.Client) (*ChangeLog, error) {
 	return &changes, nil
 }
 
+// GetSplits aggregates chunk splits by minute, charts bucket them by granularity
 func (ptr *ChangeLog) GetSplits() error {
 	pipeline := bson.A{
 		bson.D{
@@ -59,17 +76,15 @@ func (ptr *ChangeLog) GetSplits() error {
 				{Key: "what", Value: bson.D{
 					{Key: "$in", Value: bson.A{"split", "multi-split"}},
 				}},
-				{Key: "time", Value: bson.D{
-					{Key: "$exists", Value: true},
-					{Key: "$ne", Value: primitive.Null{}},
-				}},
+				{Key: "time", Value: append(GetTimeRangeFilter(ptr.since, ptr.until),
+					bson.E{Key: "$ne", Value: primitive.Null{}})},
 			}},
 		},
 		bson.D{
 			{Key: "$addFields", Value: bson.D{
-				{Key: "hour", Value: bson.D{
+				{Key: "minute", Value: bson.D{
 					{Key: "$dateToString", Value: bson.D{
-						{Key: "format", Value: "%Y-%m-%dT%H:00:00.000Z"},
+						{Key: "format", Value: "%Y-%m-%dT%H:%M:00.000Z"},
 						{Key: "date", Value: "$time"},
 					}},
 				}},
@@ -78,7 +93,7 @@ func (ptr *ChangeLog) GetSplits() error {
 		bson.D{
 			{Key: "$group", Value: bson.D{
 				{Key: "_id", Value: bson.D{
-					{Key: "hour", Value: "$hour"},
+					{Key: "minute", Value: "$minute"},
 				}},
 				{Key: "total", Value: bson.D{{Key: "$sum", Value: 1}}},
 			}},
@@ -86,7 +101,7 @@ func (ptr *ChangeLog) GetSplits() error {
 		bson.D{
 			{Key: "$project", Value: bson.D{
 				{Key: "_id", Value: 0},
-				{Key: "time", Value: bson.D{{Key: "$toDate", Value: "$_id.hour"}}},
+				{Key: "time", Value: bson.D{{Key: "$toDate", Value: "$_id.minute"}}},
 				{Key: "total", Value: 1},
 			}},
 		},
@@ -109,9 +124,13 @@ func (ptr *ChangeLog) GetSplits() error {
 	return nil
 }
 
+// GetMoveChunkErrors groups moveChunk.error events by shards, namespace, and error, and categorizes error messages
 func (ptr *ChangeLog) GetMoveChunkErrors() error {
 	pipeline := bson.A{
-		bson.D{{Key: "$match", Value: bson.D{{Key: "what", Value: "moveChunk.error"}}}},
+		bson.D{{Key: "$match", Value: bson.D{
+			{Key: "what", Value: "moveChunk.error"},
+			{Key: "time", Value: GetTimeRangeFilter(ptr.since, ptr.until)},
+		}}},
 		bson.D{
 			{Key: "$group",
 				Value: bson.D{
@@ -119,9 +138,14 @@ func (ptr *ChangeLog) GetMoveChunkErrors() error {
 						Value: bson.D{
 							{Key: "from", Value: "$details.from"},
 							{Key: "to", Value: "$details.to"},
+							{Key: "ns", Value: "$ns"},
+							{Key: "errmsg", Value: "$details.errmsg"},
+							{Key: "code", Value: "$details.code"},
 						},
 					},
 					{Key: "total", Value: bson.D{{Key: "$sum", Value: 1}}},
+					{Key: "first", Value: bson.D{{Key: "$min", Value: "$time"}}},
+					{Key: "last", Value: bson.D{{Key: "$max", Value: "$time"}}},
 				},
 			},
 		},
@@ -131,7 +155,12 @@ func (ptr *ChangeLog) GetMoveChunkErrors() error {
 					{Key: "_id", Value: 0},
 					{Key: "from", Value: "$_id.from"},
 					{Key: "to", Value: "$_id.to"},
+					{Key: "ns", Value: "$_id.ns"},
+					{Key: "errmsg", Value: "$_id.errmsg"},
+					{Key: "code", Value: "$_id.code"},
 					{Key: "total", Value: 1},
+					{Key: "first", Value: 1},
+					{Key: "last", Value: 1},
 				},
 			},
 		},
@@ -144,12 +173,34 @@ func (ptr *ChangeLog) GetMoveChunkErrors() error {
 	if err != nil {
 		return err
 	}
+	categories := map[string]*ErrorCategory{}
 	for cursor.Next(ctx) {
 		var doc ChunkMoveError
 		cursor.Decode(&doc)
+		doc.Category = GetErrorCategory(doc.Code, doc.ErrMsg)
+		AddErrorCategory(categories, doc.Category, doc.Category, doc.ErrMsg, doc.NS, doc.Total, doc.First, doc.Last)
 		ptr.ChunkMoveErrors = append(ptr.ChunkMoveErrors, doc)
 		ptr.Stats.TotalChunkMoveErrors += doc.Total
 	}
 	defer cursor.Close(ctx)
+	ptr.ChunkMoveErrorCategories = GetErrorCategories(categories)
 	return nil
 }
+
+// GetChunkMoveErrorsPage returns a page of chunk move errors
+func GetChunkMoveErrorsPage(r *http.Request, errs []ChunkMoveError) ([]ChunkMoveError, *TableQuery) {
+	q := NewTableQuery(r, "moveErrors", "total", true)
+	docs := []ChunkMoveError{}
+	for _, i := range q.Apply(len(errs), func(i int) string { return errs[i].NS },
+		map[string]func(int) interface{}{
+			"from":     func(i int) interface{} { return errs[i].From },
+			"to":       func(i int) interface{} { return errs[i].To },
+			"ns":       func(i int) interface{} { return errs[i].NS },
+			"category": func(i int) interface{} { return errs[i].Category },
+			"total":    func(i int) interface{} { return errs[i].Total },
+			"last":     func(i int) interface{} { return int64(errs[i].Last) },
+		}) {
+		docs = append(docs, errs[i])
+	}
+	return docs, q
+}
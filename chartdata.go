@@ -0,0 +1,396 @@
+/*
+ * Copyright 2023-present Kuei-chun Chen. All rights reserved.
+ * chartdata.go
+ */
+
+package bond
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	GRANULARITY_AUTO      = "auto"
+	GRANULARITY_MINUTE    = "minute"
+	GRANULARITY_5_MINUTES = "5minutes"
+	GRANULARITY_HOUR      = "hour"
+	GRANULARITY_DAY       = "day"
+	GRANULARITY_WEEK      = "week"
+)
+
+var granularityLabels = map[string]string{
+	GRANULARITY_MINUTE:    "minute",
+	GRANULARITY_5_MINUTES: "5 minutes",
+	GRANULARITY_HOUR:      "hour",
+	GRANULARITY_DAY:       "day",
+	GRANULARITY_WEEK:      "week",
+}
+
+// ChartSeries is a time series, datapoints are [value, epoch milliseconds] as expected by Grafana JSON datasources
+type ChartSeries struct {
+	Datapoints [][2]float64 `json:"datapoints"`
+	Target     string       `json:"target"`
+}
+
+// ChartAnnotation marks DDL and topology events of a bucket, time is the wall clock time of the bucket
+type ChartAnnotation struct {
+	Text  string `json:"text"`
+	Time  string `json:"time"`
+	Title string `json:"title"`
+}
+
+// ChartData holds series of a chart, times are wall clock times of datapoints in the time zone
+type ChartData struct {
+	Annotations []ChartAnnotation `json:"annotations"`
+	Attr        string            `json:"attr"`
+	From        *time.Time        `json:"from,omitempty"`
+	Granularity string            `json:"granularity"`
+	Highlight   string            `json:"highlight,omitempty"`
+	OK          int               `json:"ok"`
+	Series      []ChartSeries     `json:"series"`
+	Stacked     bool              `json:"stacked"`
+	Times       []string          `json:"times"`
+	TimeZone    string            `json:"timeZone"`
+	Title       string            `json:"title"`
+	To          *time.Time        `json:"to,omitempty"`
+	VAxis       string            `json:"vAxis"`
+}
+
+// timePoint is a datapoint before bucketing
+type timePoint struct {
+	time   time.Time
+	values []float64
+	weight float64
+}
+
+// GetChartData returns series data of a chart within a time range, bucketed by granularity in a time zone,
+// ns filters chunk ownership and splits to a collection, all collections if empty
+func (ptr *ConfigDB) GetChartData(attr string, from *time.Time, to *time.Time, granularity string, loc *time.Location,
+	ns string) (*ChartData, error) {
+	if granularity == "" {
+		granularity = GRANULARITY_AUTO
+	} else if _, ok := granularityLabels[granularity]; !ok && granularity != GRANULARITY_AUTO {
+		return nil, fmt.Errorf("unsupported granularity %v", granularity)
+	}
+	chart, ok := charts[attr]
+	if !ok || chart.Index == 0 {
+		return nil, fmt.Errorf("unsupported chart %v", attr)
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	data := ChartData{Attr: attr, From: from, OK: 1, TimeZone: loc.String(), Title: chart.Title, To: to}
+	points := []timePoint{}
+	add := func(t time.Time, weight float64, values ...float64) {
+		if (from != nil && t.Before(*from)) || (to != nil && !t.Before(*to)) {
+			return
+		}
+		points = append(points, timePoint{time: t, values: values, weight: weight})
+	}
+
+	// aggregations of targets are sum, avg weighted by point weights, max, or last
+	var targets, aggregations []string
+	if attr == T_MIGRATION_TIME {
+		targets, aggregations = []string{"Average Execution Time"}, []string{"avg"}
+		data.VAxis = "Millisecond"
+		if ptr.Actions != nil && len(ptr.BalancerAnomalies) == 0 {
+			for _, round := range ptr.Actions.BalancerRounds {
+				add(round.Time.Time(), float64(round.Rounds), round.AverageExecutionTime)
+			}
+		} else if ptr.Actions != nil {
+			// anomalies are flagged in buckets and highlighted at the highest average time
+			targets, aggregations = append(targets, "Anomalies"), append(aggregations, "max")
+			data.Highlight = "Anomalies"
+			for _, round := range ptr.Actions.BalancerRounds {
+				flag := 0.0
+				for _, anomaly := range ptr.BalancerAnomalies {
+					if round.Time >= anomaly.Start && round.Time < anomaly.End {
+						flag = 1
+					}
+				}
+				add(round.Time.Time(), float64(round.Rounds), round.AverageExecutionTime, flag)
+			}
+			for _, anomaly := range ptr.BalancerAnomalies {
+				add(anomaly.Start.Time(), 0, 0, 1)
+				add(anomaly.End.Time().Add(-time.Minute), 0, 0, 1)
+			}
+		}
+	} else if attr == T_MIGRATION_STATS {
+		// errors are charted by categories, one series each after chunks moved
+		targets, aggregations = []string{"No. of Chunks Moved"}, []string{"sum"}
+		data.Stacked = true
+		if ptr.Actions != nil {
+			indexes := map[string]int{}
+			for _, cluster := range ptr.Actions.RoundErrorClusters {
+				if _, ok := indexes[cluster.Category]; !ok {
+					indexes[cluster.Category] = len(targets)
+					targets = append(targets, "Errors: "+cluster.Category)
+					aggregations = append(aggregations, "sum")
+				}
+			}
+			for _, round := range ptr.Actions.BalancerRounds {
+				values := make([]float64, len(targets))
+				values[0] = float64(round.TotalChunksMoved)
+				add(round.Time.Time(), 1, values...)
+			}
+			for _, roundError := range ptr.Actions.RoundErrors {
+				values := make([]float64, len(targets))
+				values[indexes[roundError.Category]] = float64(roundError.Total)
+				add(roundError.Time.Time(), 1, values...)
+			}
+		}
+	} else if attr == T_CHUNK_SPLITS {
+		targets, aggregations = []string{"No. of Splits"}, []string{"sum"}
+		if ptr.Changes != nil && ns == "" {
+			for _, split := range ptr.Changes.Splits {
+				add(split.Time.Time(), 1, float64(split.Total))
+			}
+		} else if ptr.Changes != nil {
+			// splits of a collection by shards
+			data.Title += " of " + ns
+			data.Stacked = true
+			indexes := map[string]int{}
+			targets, aggregations = []string{}, []string{}
+			for _, rate := range ptr.SplitRates {
+				if rate.NS != ns {
+					continue
+				}
+				for _, shard := range rate.Shards {
+					indexes[shard.Name] = len(targets)
+					targets = append(targets, shard.Name)
+					aggregations = append(aggregations, "sum")
+				}
+			}
+			for _, split := range ptr.Changes.NamespaceSplits {
+				if split.NS == ns {
+					values := make([]float64, len(targets))
+					values[indexes[split.Shard]] = float64(split.Total)
+					add(split.Time.Time(), 1, values...)
+				}
+			}
+		}
+	} else if attr == T_MIGRATION_LATENCY || attr == T_MIGRATION_STEPS {
+		if attr == T_MIGRATION_LATENCY {
+			targets, aggregations = []string{"Average Migration Time", "Max Migration Time"}, []string{"avg", "max"}
+		} else {
+			targets = []string{"Clone", "Catch-up", "Critical Section", "Commit"}
+			aggregations = []string{"avg", "avg", "avg", "avg"}
+			data.Stacked = true
+		}
+		data.VAxis = "Millisecond"
+		if ptr.Changes != nil {
+			for _, m := range ptr.Changes.Migrations {
+				if !m.Success {
+					continue
+				}
+				if attr == T_MIGRATION_LATENCY {
+					add(m.Time.Time(), 1, float64(m.Duration), float64(m.Duration))
+				} else {
+					add(m.Time.Time(), 1, float64(m.Clone), float64(m.CatchUp), float64(m.CriticalSection), float64(m.Commit))
+				}
+			}
+		}
+	} else if attr == T_CHUNK_OWNERSHIP {
+		history := ptr.GetChunkOwnership(ns)
+		shards := []string{}
+		if len(history) > 0 {
+			for name := range history[0].Shards {
+				shards = append(shards, name)
+			}
+		}
+		sort.Strings(shards)
+		targets = append(shards, "Spread (max - min)")
+		for range targets {
+			aggregations = append(aggregations, "last")
+		}
+		if ns != "" {
+			data.Title += " of " + ns
+		}
+		data.VAxis = "Chunks"
+		for _, ownership := range history {
+			if ptr.Until != nil && !ownership.Time.Before(*ptr.Until) {
+				break
+			}
+			values := []float64{}
+			min, max := math.MaxInt, 0
+			for _, name := range shards {
+				chunks := ownership.Shards[name]
+				values = append(values, float64(chunks))
+				if chunks < min {
+					min = chunks
+				}
+				if chunks > max {
+					max = chunks
+				}
+			}
+			add(ownership.Time, 1, append(values, float64(max-min))...)
+		}
+	}
+
+	if granularity == GRANULARITY_AUTO {
+		var span time.Duration
+		if len(points) > 0 {
+			first, last := points[0].time, points[0].time
+			for _, point := range points {
+				if point.time.Before(first) {
+					first = point.time
+				} else if point.time.After(last) {
+					last = point.time
+				}
+			}
+			span = last.Sub(first)
+		}
+		granularity = GetAutoGranularity(span)
+	}
+	data.Granularity = granularity
+	if attr == T_MIGRATION_STATS {
+		data.VAxis = "Chunks Moved per " + granularityLabels[granularity]
+	} else if attr == T_CHUNK_SPLITS {
+		data.VAxis = "Splits per " + granularityLabels[granularity]
+	}
+
+	buckets := map[int64]*timePoint{}
+	for _, point := range points {
+		t := TruncateTime(point.time, granularity, loc)
+		bucket, ok := buckets[t.UnixMilli()]
+		if !ok {
+			bucket = &timePoint{time: t, values: make([]float64, len(point.values))}
+			buckets[t.UnixMilli()] = bucket
+		}
+		for i, value := range point.values {
+			if aggregations[i] == "last" {
+				bucket.values[i] = value
+			} else if aggregations[i] == "max" {
+				bucket.values[i] = math.Max(bucket.values[i], value)
+			} else if aggregations[i] == "avg" {
+				bucket.values[i] += value * point.weight
+			} else {
+				bucket.values[i] += value
+			}
+		}
+		bucket.weight += point.weight
+	}
+	list := []*timePoint{}
+	for _, bucket := range buckets {
+		list = append(list, bucket)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].time.Before(list[j].time)
+	})
+	data.Times = []string{}
+	for _, bucket := range list {
+		data.Times = append(data.Times, bucket.time.Format("2006-01-02T15:04:05"))
+	}
+	for i, target := range targets {
+		series := ChartSeries{Datapoints: [][2]float64{}, Target: target}
+		for _, bucket := range list {
+			value := bucket.values[i]
+			if aggregations[i] == "avg" && bucket.weight > 0 {
+				value /= bucket.weight
+			}
+			series.Datapoints = append(series.Datapoints, [2]float64{value, float64(bucket.time.UnixMilli())})
+		}
+		data.Series = append(data.Series, series)
+	}
+	if data.Highlight != "" {
+		highest := 0.0
+		for _, datapoint := range data.Series[0].Datapoints {
+			highest = math.Max(highest, datapoint[0])
+		}
+		for _, series := range data.Series {
+			if series.Target != data.Highlight {
+				continue
+			}
+			for i := range series.Datapoints {
+				series.Datapoints[i][0] *= highest
+			}
+		}
+	}
+	if attr == T_MIGRATION_TIME || attr == T_MIGRATION_STATS || attr == T_CHUNK_SPLITS {
+		data.Annotations = ptr.getChartAnnotations(from, to, granularity, loc)
+	}
+	return &data, nil
+}
+
+// getChartAnnotations returns DDL and topology events bucketed by granularity
+func (ptr *ConfigDB) getChartAnnotations(from *time.Time, to *time.Time, granularity string, loc *time.Location) []ChartAnnotation {
+	annotations := []ChartAnnotation{}
+	if ptr.Changes == nil {
+		return annotations
+	}
+	types := map[string]map[string]bool{}
+	for _, event := range ptr.Changes.ChangeEvents {
+		t := event.Time.Time()
+		if (from != nil && t.Before(*from)) || (to != nil && !t.Before(*to)) {
+			continue
+		}
+		bucket := TruncateTime(t, granularity, loc).Format("2006-01-02T15:04:05")
+		if len(annotations) == 0 || annotations[len(annotations)-1].Time != bucket {
+			annotations = append(annotations, ChartAnnotation{Time: bucket})
+			types[bucket] = map[string]bool{}
+		}
+		annotation := &annotations[len(annotations)-1]
+		if !types[bucket][event.Type] {
+			types[bucket][event.Type] = true
+			if annotation.Text != "" {
+				annotation.Text += ", "
+			}
+			annotation.Text += event.Type
+		}
+		if annotation.Title != "" {
+			annotation.Title += "\n"
+		}
+		annotation.Title += event.Time.Time().In(loc).Format("15:04:05") + " " + event.What + " " + event.NS
+	}
+	return annotations
+}
+
+// GetAutoGranularity returns a granularity keeping a chart readable for the time span
+func GetAutoGranularity(span time.Duration) string {
+	if span <= 6*time.Hour {
+		return GRANULARITY_MINUTE
+	} else if span <= 48*time.Hour {
+		return GRANULARITY_5_MINUTES
+	} else if span <= 30*24*time.Hour {
+		return GRANULARITY_HOUR
+	} else if span <= 180*24*time.Hour {
+		return GRANULARITY_DAY
+	}
+	return GRANULARITY_WEEK
+}
+
+// TruncateTime truncates time to the beginning of its bucket in a time zone, weeks start on Monday
+func TruncateTime(t time.Time, granularity string, loc *time.Location) time.Time {
+	t = t.In(loc)
+	year, month, day := t.Date()
+	switch granularity {
+	case GRANULARITY_MINUTE:
+		return time.Date(year, month, day, t.Hour(), t.Minute(), 0, 0, loc)
+	case GRANULARITY_5_MINUTES:
+		return time.Date(year, month, day, t.Hour(), t.Minute()-t.Minute()%5, 0, 0, loc)
+	case GRANULARITY_DAY:
+		return time.Date(year, month, day, 0, 0, 0, 0, loc)
+	case GRANULARITY_WEEK:
+		return time.Date(year, month, day-(int(t.Weekday())+6)%7, 0, 0, 0, 0, loc)
+	}
+	return time.Date(year, month, day, t.Hour(), 0, 0, 0, loc)
+}
+
+// ParseTime parses a time in RFC3339, yyyy-mm-ddThh:mm, or yyyy-mm-dd format, times without offset are in loc
+func ParseTime(str string, loc *time.Location) (*time.Time, error) {
+	if str == "" {
+		return nil, nil
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, str, loc); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid time %v", str)
+}
@@ -0,0 +1,63 @@
+/*
+ * Copyright 2023-present Kuei-chun Chen. All rights reserved.
+ * chartdata_test.go
+ */
+
+package bond
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetAutoGranularity(t *testing.T) {
+	tests := []struct {
+		span        time.Duration
+		granularity string
+	}{
+		{0, GRANULARITY_MINUTE},
+		{6 * time.Hour, GRANULARITY_MINUTE},
+		{6*time.Hour + time.Second, GRANULARITY_5_MINUTES},
+		{48 * time.Hour, GRANULARITY_5_MINUTES},
+		{7 * 24 * time.Hour, GRANULARITY_HOUR},
+		{90 * 24 * time.Hour, GRANULARITY_DAY},
+		{365 * 24 * time.Hour, GRANULARITY_WEEK},
+	}
+	for _, tc := range tests {
+		if granularity := GetAutoGranularity(tc.span); granularity != tc.granularity {
+			t.Errorf("GetAutoGranularity(%v) = %v, want %v", tc.span, granularity, tc.granularity)
+		}
+	}
+}
+
+func TestTruncateTime(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	tm := time.Date(2023, 3, 15, 14, 37, 52, 123, time.UTC) // a Wednesday, 10:37:52 in New York
+	tests := []struct {
+		granularity string
+		loc         *time.Location
+		want        string
+	}{
+		{GRANULARITY_MINUTE, time.UTC, "2023-03-15T14:37:00Z"},
+		{GRANULARITY_5_MINUTES, time.UTC, "2023-03-15T14:35:00Z"},
+		{GRANULARITY_HOUR, time.UTC, "2023-03-15T14:00:00Z"},
+		{GRANULARITY_DAY, time.UTC, "2023-03-15T00:00:00Z"},
+		{GRANULARITY_WEEK, time.UTC, "2023-03-13T00:00:00Z"},
+		{"", time.UTC, "2023-03-15T14:00:00Z"},
+		{GRANULARITY_HOUR, ny, "2023-03-15T10:00:00-04:00"},
+		{GRANULARITY_DAY, ny, "2023-03-15T00:00:00-04:00"},
+		{GRANULARITY_WEEK, ny, "2023-03-13T00:00:00-04:00"},
+	}
+	for _, tc := range tests {
+		if got := TruncateTime(tm, tc.granularity, tc.loc).Format(time.RFC3339); got != tc.want {
+			t.Errorf("TruncateTime(%v, %v, %v) = %v, want %v", tm, tc.granularity, tc.loc, got, tc.want)
+		}
+	}
+	sunday := time.Date(2023, 3, 19, 23, 0, 0, 0, time.UTC)
+	if got := TruncateTime(sunday, GRANULARITY_WEEK, time.UTC).Format(time.RFC3339); got != "2023-03-13T00:00:00Z" {
+		t.Errorf("TruncateTime(%v, week) = %v, weeks start on Monday", sunday, got)
+	}
+}
@@ -7,8 +7,6 @@ package bond
 
 import (
 	"html/template"
-
-	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func GetPieChartTemplate() (*template.Template, error) {
@@ -33,7 +31,7 @@ func GetPieChartTemplate() (*template.Template, error) {
 			'backgroundColor': { 'fill': 'transparent' },
 			'title': '{{.Title}}',
 			'width': '100%',
-			'height': 480,
+			'height': {{.Options.Height}},
 			'titleTextStyle': {'fontSize': 20},
 			'slices': {},
 			'legend': { 'position': 'bottom' } };
@@ -50,138 +48,118 @@ func GetPieChartTemplate() (*template.Template, error) {
 	return template.New("bond").Funcs(template.FuncMap{}).Parse(html)
 }
 
-// GetChartTemplate returns HTML
-func GetChartTemplate(chartType string) (*template.Template, error) {
+// GetChartTemplate returns HTML, chart data are from /api/bond/v1.0/charts/:attr
+func GetChartTemplate() (*template.Template, error) {
 	html := GetContentHTML()
-	if chartType == T_MIGRATION_STATS {
-		html += MigrationStatsChartHTML
-	} else if chartType == T_MIGRATION_TIME {
-		html += MigrationTimeChartHTML
-	} else if chartType == T_CHUNK_SPLITS {
-		html += ChunkSplitsChartHTML
-	}
+	html += TimelineChartHTML
+	html += ChartOptionsHTML
 	html += `<div id='bondChart' class='chart' style="clear: left;"></div></body></html>`
 
 	return template.New("bond").Funcs(template.FuncMap{
-		"ISODate": func(t *primitive.DateTime) string {
-			if t == nil {
-				return ""
-			}
-			layout := "2006-01-02T15:04:05Z"
-			return t.Time().Format(layout)
+		"list": func(items ...string) []string {
+			return items
 		}}).Parse(html)
 }
 
 const (
-	MigrationTimeChartHTML = `
-	<script>
-		setChartType();
-	</script>
-{{ if and (.Config.Actions) (gt (len .Config.Actions.BalancerRounds) 0) }}
-<script>
-	google.charts.load('current', {'packages':['corechart']});
-	google.charts.setOnLoadCallback(drawChart);
-
-	function drawChart() {
-		var data = google.visualization.arrayToDataTable([
-			['Date/Time', 'Average Execution Time'],
-
-	{{range $i, $v := .Config.Actions.BalancerRounds}}
-		[new Date("{{ISODate $v.Time}}"), {{$v.AverageExecutionTime}}],
+	ChartOptionsHTML = `
+<div style='float: left;'>
+	<select style="margin: 0px 0px; padding: 0px 0px; font-size: 1em" onchange="setQueryParam('type', this.value)">
+	{{range $v := (list "column" "line" "area" "stepped")}}
+		<option value='{{$v}}'{{if eq $v $.Options.Type}} selected{{end}}>{{$v}} chart</option>
 	{{end}}
-		]);
-		// Set chart options
-		var options = {
-			'backgroundColor': { 'fill': 'transparent' },
-			'title': '{{.Title}}',
-			'hAxis': { slantedText: true, slantedTextAngle: 30 },
-			'vAxis': {title: 'Millisecond', minValue: 0},
-			'width': '100%',
-			'height': 480,
-			'titleTextStyle': {'fontSize': 20},
-			'explorer': { actions: ['dragToZoom', 'rightClickToReset'] },
-			'legend': { 'position': 'bottom' } };
-		// Instantiate and draw our chart, passing in some options.
-		var chart = new google.visualization.ColumnChart(document.getElementById('bondChart'));
-		chart.draw(data, options);
-	}
-</script>
-{{else}}
-<div align='center' class='btn'><span style='color: red'>no data found</span></div>
-{{end}}`
-
-	MigrationStatsChartHTML = `
-	<script>
-		setChartType();
-	</script>
-{{ if and (.Config.Actions) (gt (len .Config.Actions.BalancerRounds) 0) }}
-<script>
-	google.charts.load('current', {'packages':['corechart']});
-	google.charts.setOnLoadCallback(drawChart);
-
-	function drawChart() {
-		var data = google.visualization.arrayToDataTable([
-			['Date/Time', 'No. of Chunks Moved', 'Error Count'],
-
-	{{range $i, $v := .Config.Actions.BalancerRounds}}
-		[new Date("{{ISODate $v.Time}}"), {{$v.TotalChunksMoved}}, {{$v.TotalErrors}}],
+	</select>
+	<select style="margin: 0px 0px; padding: 0px 0px; font-size: 1em" onchange="setQueryParam('granularity', this.value)">
+	{{range $v := (list "auto" "minute" "5minutes" "hour" "day" "week")}}
+		<option value='{{$v}}'{{if eq $v $.Options.Granularity}} selected{{end}}>by {{$v}}</option>
 	{{end}}
-		]);
-		// Set chart options
-		var options = {
-			'backgroundColor': { 'fill': 'transparent' },
-			'title': '{{.Title}}',
-			'hAxis': { slantedText: true, slantedTextAngle: 30 },
-			'vAxis': {title: 'Chunks Moved per Hour', minValue: 0},
-			'width': '100%',
-			'height': 480,
-			'isStacked': true,
-			'titleTextStyle': {'fontSize': 20},
-			'explorer': { actions: ['dragToZoom', 'rightClickToReset'] },
-			'legend': { 'position': 'bottom' } };
-		// Instantiate and draw our chart, passing in some options.
-		var chart = new google.visualization.ColumnChart(document.getElementById('bondChart'));
-		chart.draw(data, options);
-	}
-</script>
-{{else}}
-<div align='center' class='btn'><span style='color: red'>no data found</span></div>
-{{end}}`
+	</select>
+	{{if or (eq .Attr "chunk_ownership") (eq .Attr "splits")}}
+	<select style="margin: 0px 0px; padding: 0px 0px; font-size: 1em" onchange="setQueryParam('ns', this.value)">
+		<option value=''>all collections</option>
+	{{range $ns, $v := .Config.CollectionsMap}}
+		<option value='{{$ns}}'{{if eq $ns $.Options.NS}} selected{{end}}>{{$ns}}</option>
+	{{end}}
+	</select>
+	{{end}}
+	time zone <input type='text' placeholder='UTC' size='16' value='{{.Options.TimeZone}}' onchange="setQueryParam('tz', this.value)"/>
+	since <input type='text' placeholder='yyyy-mm-ddThh:mm' size='16' value='{{.Options.Since}}' onchange="setQueryParam('since', this.value)"/>
+	until <input type='text' placeholder='yyyy-mm-ddThh:mm' size='16' value='{{.Options.Until}}' onchange="setQueryParam('until', this.value)"/>
+</div>`
 
-	ChunkSplitsChartHTML = `
-	<script>
-		setChartType();
-	</script>
-{{ if and (.Config.Changes) (gt (len .Config.Changes.Splits) 0) }}
+	TimelineChartHTML = `
 <script>
+	setChartType();
 	google.charts.load('current', {'packages':['corechart']});
 	google.charts.setOnLoadCallback(drawChart);
 
 	function drawChart() {
-		var data = google.visualization.arrayToDataTable([
-			['Date/Time', 'No. of Splits'],
-
-	{{range $i, $v := .Config.Changes.Splits}}
-		[new Date("{{ISODate $v.Time}}"), {{$v.Total}}],
-	{{end}}
-		]);
-		// Set chart options
-		var options = {
-			'backgroundColor': { 'fill': 'transparent' },
-			'title': '{{.Title}}',
-			'hAxis': { slantedText: true, slantedTextAngle: 30 },
-			'vAxis': {title: 'Millisecond', minValue: 0},
-			'width': '100%',
-			'height': 480,
-			'titleTextStyle': {'fontSize': 20},
-			'explorer': { actions: ['dragToZoom', 'rightClickToReset'] },
-			'legend': { 'position': 'bottom' } };
-		// Instantiate and draw our chart, passing in some options.
-		var chart = new google.visualization.ColumnChart(document.getElementById('bondChart'));
-		chart.draw(data, options);
+		fetch('/api/bond/v1.0/charts/' + {{.Attr}} + window.location.search)
+			.then(response => response.json())
+			.then(doc => {
+				if (doc.ok == 0 || doc.series.length == 0 || doc.series[0].datapoints.length == 0) {
+					document.getElementById('bondChart').innerHTML =
+						"<div align='center' class='btn'><span style='color: red'>" + (doc.error || 'no data found') + "</span></div>";
+					return;
+				}
+				var data = new google.visualization.DataTable();
+				var annotations = {};
+				(doc.annotations || []).forEach(a => annotations[a.time] = a);
+				var toDate = function(t) {
+					// wall clock times in the selected time zone
+					var toks = t.split(/[-T:]/).map(Number);
+					return new Date(toks[0], toks[1]-1, toks[2], toks[3], toks[4], toks[5]);
+				};
+				var annotate = function(row, t) {
+					var a = annotations[t];
+					row.splice(2, 0, a ? a.text : null, a ? a.title : null);
+					delete annotations[t];
+					return row;
+				};
+				data.addColumn('datetime', 'Date/Time');
+				doc.series.forEach((series, i) => {
+					data.addColumn('number', series.target);
+					if (i == 0) {
+						// DDL and topology events
+						data.addColumn({type: 'string', role: 'annotation'});
+						data.addColumn({type: 'string', role: 'annotationText'});
+					}
+				});
+				data.addRows(doc.times.map((t, i) => {
+					var row = [toDate(t)];
+					doc.series.forEach(series => row.push(series.datapoints[i][0]));
+					return annotate(row, t);
+				}));
+				// events without datapoints
+				Object.keys(annotations).forEach(t => {
+					data.addRow(annotate([toDate(t)].concat(doc.series.map(series => null)), t));
+				});
+				data.sort([{column: 0}]);
+				// Set chart options
+				var options = {
+					'backgroundColor': { 'fill': 'transparent' },
+					'title': doc.title,
+					'hAxis': { title: doc.timeZone, slantedText: true, slantedTextAngle: 30 },
+					'vAxis': {title: doc.vAxis, minValue: 0},
+					'width': '100%',
+					'height': {{.Options.Height}},
+					'isStacked': doc.stacked,
+					'interpolateNulls': true,
+					'annotations': { 'style': 'line' },
+					'titleTextStyle': {'fontSize': 20},
+					'explorer': { actions: ['dragToZoom', 'rightClickToReset'] },
+					'legend': { 'position': 'bottom' } };
+				// highlighted time ranges
+				doc.series.forEach((series, i) => {
+					if (series.target == doc.highlight) {
+						options['series'] = {};
+						options['series'][i] = { 'color': '#f4cccc', 'areaOpacity': 0.5 };
+					}
+				});
+				// Instantiate and draw our chart, passing in some options.
+				var chart = new google.visualization[{{.Options.ChartType}}](document.getElementById('bondChart'));
+				chart.draw(data, options);
+			});
 	}
-</script>
-{{else}}
-<div align='center' class='btn'><span style='color: red'>no data found</span></div>
-{{end}}`
+</script>`
 )
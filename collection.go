@@ -0,0 +1,205 @@
+/*
+ * Copyright 2023-present Kuei-chun Chen. All rights reserved.
+ * collection.go
+ */
+
+package bond
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/simagix/keyhole/mdb"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ReshardingFields is state of an in progress reshardCollection, since 5.0
+type ReshardingFields struct {
+	State string           `bson:"state"`
+	UUID  primitive.Binary `bson:"uuid"`
+}
+
+// TimeseriesFields is options of a sharded time-series collection, since 5.1
+type TimeseriesFields struct {
+	BucketMaxSpanSeconds int64  `bson:"bucketMaxSpanSeconds"`
+	Granularity          string `bson:"granularity"`
+	MetaField            string `bson:"metaField"`
+	TimeField            string `bson:"timeField"`
+}
+
+// CollectionShard is chunks and data size of a collection on a shard
+type CollectionShard struct {
+	Chunks int    `bson:"chunks"`
+	Jumbo  int    `bson:"jumbo"`
+	Shard  string `bson:"shard"`
+	Size   int64  `bson:"size"`
+}
+
+// IsMigrationsDisabled returns true if setAllowMigrations disabled chunk migrations of the collection, decoded
+// from either permitMigrations or allowMigrations depending on the version
+func (ptr ConfigCollection) IsMigrationsDisabled() bool {
+	return (ptr.AllowMigrations != nil && !*ptr.AllowMigrations) || (ptr.PermitMigrations != nil && !*ptr.PermitMigrations)
+}
+
+// HasCustomChunkSize returns true if configureCollectionBalancing set a chunk size other than the cluster default
+func (ptr ConfigCollection) HasCustomChunkSize(chunkSizeMB int) bool {
+	return ptr.MaxChunkSizeBytes > 0 && ptr.MaxChunkSizeBytes != int64(chunkSizeMB)*1024*1024
+}
+
+// GetTimestamp returns time of the collection timestamp, set when sharded or its shard key changed since 5.0
+func (ptr ConfigCollection) GetTimestamp() *time.Time {
+	if ptr.Timestamp == nil {
+		return nil
+	}
+	t := time.Unix(int64(ptr.Timestamp.T), 0)
+	return &t
+}
+
+type CollectionInfo struct {
+	ConfigCollection `bson:",inline"`
+	IsMongos         bool              `bson:"isMongos"`
+	Jumbo            int               `bson:"jumbo"`
+	Shards           []CollectionShard `bson:"shards"`
+}
+
+// GetCollectionInfo returns chunks by shards and shard key assessment of a sharded collection. If connected to
+// a mongos, the shard key is reassessed with the sampled leading field type and supporting indexes of shards.
+func (ptr *ConfigDB) GetCollectionInfo(ns string) (*CollectionInfo, error) {
+	log.Println("GetCollectionInfo()", ns)
+	coll, ok := ptr.getCollection(ns)
+	if !ok {
+		return nil, fmt.Errorf("sharded collection %v not found", ns)
+	}
+	ns = coll.ID
+	info := CollectionInfo{ConfigCollection: coll}
+	for name := range ptr.ShardsMap {
+		info.Shards = append(info.Shards, CollectionShard{Chunks: coll.shards[name], Shard: name, Size: coll.Balance.ShardSizes[name]})
+	}
+	for _, chunk := range ptr.Chunks {
+		if chunk.NS != ns {
+			continue
+		}
+		info.Jumbo += chunk.Jumbo
+		for i := range info.Shards {
+			if info.Shards[i].Shard == chunk.Shard {
+				info.Shards[i].Jumbo += chunk.Jumbo
+			}
+		}
+	}
+	sort.Slice(info.Shards, func(i, j int) bool {
+		return info.Shards[i].Shard < info.Shards[j].Shard
+	})
+
+	if ptr.clusterType != mdb.Sharded {
+		return &info, nil
+	}
+	info.IsMongos = true
+	leadingType, err := ptr.getLeadingType(&coll)
+	if err != nil {
+		log.Println("sample", ns, "error", err)
+	}
+	indexes, err := ptr.getShardIndexes(&coll)
+	if err != nil {
+		log.Println("$indexStats", ns, "error", err)
+	}
+	info.Assessment = assessCollectionShardKey(&coll, info.Jumbo, leadingType, indexes)
+	return &info, nil
+}
+
+// GetCollectionTemplate returns HTML
+func GetCollectionTemplate() (*template.Template, error) {
+	html := GetContentHTML()
+	html += CollectionInfoHTML + ShardKeyHTML + CollectionShardsHTML + AnalyzeShardKeyHTML
+	html += "</body></html>"
+	return template.New("bond").Funcs(infoFuncMap()).Parse(html)
+}
+
+const (
+	// collection summary
+	CollectionInfoHTML = `<div style='float: left; clear: left;'>
+		<table width=400px><caption>Collection {{.Collection.GetName}}</caption><tr><th>Metric</th><th>Value</th>
+			<tr><td align='left' class='rowtitle'>Shard Key</td><td align='left' class='break'>{{ stringify .Collection.GetUserKey }}</td></tr>
+		{{if .Collection.IsTimeseries}}
+			<tr><td align='left' class='rowtitle'>Buckets Collection</td><td align='left' class='break'>{{ .Collection.ID }}</td></tr>
+			<tr><td align='left' class='rowtitle'>Buckets Shard Key</td><td align='left' class='break'>{{ stringify .Collection.Key }}</td></tr>
+		{{end}}
+		{{with .Collection.TimeseriesFields}}
+			<tr><td align='left' class='rowtitle'>Time Field</td><td align='left' class='break'>{{ .TimeField }}</td></tr>
+			<tr><td align='left' class='rowtitle'>Meta Field</td><td align='left' class='break'>{{ .MetaField }}</td></tr>
+			<tr><td align='left' class='rowtitle'>Granularity</td><td align='left' class='break'>{{ .Granularity }}{{if .BucketMaxSpanSeconds}} (bucket max span {{ getDurationFromSeconds .BucketMaxSpanSeconds }}){{end}}</td></tr>
+		{{end}}
+			<tr><td align='left' class='rowtitle'>Unique</td><td align='center' class='break'>{{ getCheckMarkSymbol .Collection.Unique }}</td></tr>
+			<tr><td align='left' class='rowtitle'>No Balance</td><td align='center' class='break'>{{ getCheckMarkSymbol .Collection.NoBalance }}</td></tr>
+			<tr><td align='left' class='rowtitle'>Number of Chunks</td><td align='right' class='break'>{{ numPrinter .Collection.Chunks }}</td></tr>
+			<tr><td align='left' class='rowtitle'>Jumbo Chunks</td><td align='right' class='break'>{{ numPrinter .Collection.Jumbo }} {{getWarningSymbol (eq .Collection.Jumbo 0) }}</td></tr>
+			<tr><td align='left' class='rowtitle'>Balance Score</td><td align='right' class='break'>{{ printf "%.0f%%" .Collection.Balance.Score }} {{getWarningSymbol (not .Collection.Balance.IsImbalanced) }}</td></tr>
+			<tr><td align='left' class='rowtitle'>Chunks Difference (Threshold)</td><td align='right' class='break'>{{ .Collection.Balance.Difference }} ({{ .Collection.Balance.Threshold }})</td></tr>
+			{{if .Collection.Balance.SizeThreshold}}<tr><td align='left' class='rowtitle'>Data Size Difference (Threshold)</td><td align='right' class='break'>{{ getStorageSize .Collection.Balance.SizeDifference }} ({{ getStorageSize .Collection.Balance.SizeThreshold }})</td></tr>{{end}}
+			{{if .Collection.Zones}}<tr><td align='left' class='rowtitle'>Zones</td><td align='right' class='break'>{{range $i, $zone := .Collection.Zones}}{{if $i}}, {{end}}{{$zone}}{{end}}</td></tr>{{end}}
+		{{if .Collection.Timestamp}}
+			<tr><td align='left' class='rowtitle'>Timestamp</td><td align='right' class='break'>{{ ISOTime .Collection.GetTimestamp }}</td></tr>
+		{{end}}
+			<tr><td align='left' class='rowtitle'>Migrations Allowed</td><td align='center' class='break'>{{if .Collection.IsMigrationsDisabled}}{{getWarningSymbol false}}{{else}}{{getCheckMarkSymbol true}}{{end}}</td></tr>
+		{{if .Collection.MaxChunkSizeBytes}}
+			<tr><td align='left' class='rowtitle'>Chunk Size (Cluster Default)</td><td align='right' class='break'>{{ getStorageSize .Collection.MaxChunkSizeBytes }} ({{ .Config.ChunkSize }}MB) {{getWarningSymbol (not (.Collection.HasCustomChunkSize .Config.ChunkSize)) }}</td></tr>
+		{{end}}
+		{{if .Collection.NoAutoSplit}}
+			<tr><td align='left' class='rowtitle'>No Auto Split</td><td align='center' class='break'>{{ getCheckMarkSymbol .Collection.NoAutoSplit }}</td></tr>
+		{{end}}
+		{{if .Collection.DefragmentCollection}}
+			<tr><td align='left' class='rowtitle'>Defragmenting</td><td align='center' class='break'>{{ getCheckMarkSymbol .Collection.DefragmentCollection }}</td></tr>
+		{{end}}
+		{{if .Collection.ReshardingFields}}
+			<tr><td align='left' class='rowtitle'>Resharding</td><td align='center' class='break'>{{ .Collection.ReshardingFields.State }}</td></tr>
+		{{end}}
+		{{if .Collection.Compliance}}
+			<tr><td align='left' class='rowtitle'>Balancer Compliant</td><td align='center' class='break'>{{if .Collection.Compliance.BalancerCompliant}}{{getCheckMarkSymbol true}}{{else}}{{ .Collection.Compliance.FirstComplianceViolation }} {{getWarningSymbol false}}{{end}}</td></tr>
+		{{end}}
+		</table></div>`
+
+	// shard key assessment
+	ShardKeyHTML = `<div style='float: left;'>
+		{{$assessment := .Collection.Assessment}}
+		<table width=400px><caption>Shard Key Assessment</caption><tr><th>Metric</th><th>Value</th>
+			<tr><td align='left' class='rowtitle'>Rating</td><td align='center' class='break'>{{ $assessment.Rating }} {{getWarningSymbol (ne $assessment.Rating "poor") }}</td></tr>
+			<tr><td align='left' class='rowtitle'>Hashed</td><td align='center' class='break'>{{ getCheckMarkSymbol $assessment.IsHashed }}</td></tr>
+			<tr><td align='left' class='rowtitle'>Monotonic</td><td align='center' class='break'>{{ getCheckMarkSymbol $assessment.IsMonotonic }}</td></tr>
+		{{if .Collection.IsMongos}}
+			<tr><td align='left' class='rowtitle'>Leading Field Type</td><td align='center' class='break'>{{ $assessment.LeadingType }}</td></tr>
+		{{else}}
+			<tr><td align='left' class='rowtitle'>Leading Field Type</td><td align='left' class='break'>available when connected to a mongos</td></tr>
+		{{end}}
+		{{range $i, $explanation := $assessment.Explanations}}
+			<tr><td align='left' class='rowtitle'>{{if eq $i 0}}Explanations{{end}}</td><td align='left' class='break'>{{ $explanation }}</td></tr>
+		{{end}}
+		</table></div>`
+
+	// chunks of a collection by shards
+	CollectionShardsHTML = `
+{{if gt (len .Collection.Shards) 0}}
+	<div style='float: left;'>
+	<table><caption>Chunks by Shards</caption><tr><th>#</th>
+	<th>Shard Name</th><th>Chunks</th><th>Jumbo</th><th>Data Size</th>{{if .Collection.IsMongos}}<th>Supporting Index</th>{{end}}
+	{{$indexes := .Collection.Assessment.ShardIndexes}}
+	{{range $n, $value := .Collection.Shards}}
+			<tr>
+				<td align='right' class='break'>{{ add $n 1 }}</td>
+				<td align='left' class='break'>{{ $value.Shard }}</td>
+				<td align='right' class='break'>{{ numPrinter $value.Chunks }}</td>
+				<td align='right' class='break'>{{ numPrinter $value.Jumbo }}</td>
+				<td align='right' class='break'>{{ getStorageSize $value.Size }}</td>
+			{{if $.Collection.IsMongos}}
+				{{if gt $value.Chunks 0}}
+				<td align='center' class='break'>{{if index $indexes $value.Shard}}{{getCheckMarkSymbol true}}{{else}}{{getWarningSymbol false}}{{end}}</td>
+				{{else}}
+				<td align='center' class='break'>-</td>
+				{{end}}
+			{{end}}
+			</tr>
+	{{end}}
+	</table></div>
+{{end}}`
+)
@@ -0,0 +1,36 @@
+/*
+ * Copyright 2023-present Kuei-chun Chen. All rights reserved.
+ * compliance.go
+ */
+
+package bond
+
+import (
+	"context"
+	"log"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// BalancerCompliance is the balancer's own view of a collection from balancerCollectionStatus, since 4.4. The
+// first violation is one of draining, zoneViolation, chunksImbalance and, since 7.0, defragmentingChunks.
+type BalancerCompliance struct {
+	BalancerCompliant        bool   `bson:"balancerCompliant"`
+	FirstComplianceViolation string `bson:"firstComplianceViolation"`
+}
+
+// GetBalancerCompliance runs balancerCollectionStatus of sharded collections via a mongos, since 4.4
+func (ptr *ConfigDB) GetBalancerCompliance() {
+	log.Println("GetBalancerCompliance()")
+	ctx := context.Background()
+	for ns, coll := range ptr.CollectionsMap {
+		var doc BalancerCompliance
+		err := ptr.client.Database("admin").RunCommand(ctx, bson.D{{Key: "balancerCollectionStatus", Value: ns}}).Decode(&doc)
+		if err != nil {
+			log.Println("balancerCollectionStatus", ns, "error", err)
+			continue
+		}
+		coll.Compliance = &doc
+		ptr.CollectionsMap[ns] = coll
+	}
+}
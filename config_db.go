@@ -8,10 +8,15 @@ package bond
 import (
 	"context"
 	"errors"
+	"html/template"
 	"log"
 	"net/url"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/simagix/gox"
 	"github.com/simagix/keyhole/mdb"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -21,6 +26,10 @@ import (
 	"golang.org/x/text/message"
 )
 
+const (
+	MAX_TIME_WINDOWS = 16 // time windows of which scoped ConfigDB are cached
+)
+
 var instance *ConfigDB
 
 // GetConfigDB returns ConfigDB instance
@@ -40,13 +49,25 @@ type ConfigChunk struct {
 }
 
 type ConfigCollection struct {
-	Chunks    int    `bson:"chunks"`
-	Dropped   bool   `bson:"dropped"`
-	ID        string `bson:"_id"`
-	Key       bson.D `bson:"key"`
-	NoBalance bool   `bson:"noBalance"`
-	Unique    bool   `bson:"unique"`
-	UUID      primitive.Binary
+	AllowMigrations      *bool                `bson:"allowMigrations"`
+	Assessment           ShardKeyAssessment   `bson:"assessment"`
+	Balance              CollectionBalance    `bson:"balance"`
+	Chunks               int                  `bson:"chunks"`
+	Compliance           *BalancerCompliance  `bson:"compliance"`
+	DefragmentCollection bool                 `bson:"defragmentCollection"`
+	Dropped              bool                 `bson:"dropped"`
+	ID                   string               `bson:"_id"`
+	Key                  bson.D               `bson:"key"`
+	MaxChunkSizeBytes    int64                `bson:"maxChunkSizeBytes"`
+	NoAutoSplit          bool                 `bson:"noAutoSplit"`
+	NoBalance            bool                 `bson:"noBalance"`
+	PermitMigrations     *bool                `bson:"permitMigrations"`
+	ReshardingFields     *ReshardingFields    `bson:"reshardingFields"`
+	TimeseriesFields     *TimeseriesFields    `bson:"timeseriesFields"`
+	Timestamp            *primitive.Timestamp `bson:"timestamp"`
+	Unique               bool                 `bson:"unique"`
+	UUID                 primitive.Binary
+	Zones                []string `bson:"zones"` // zones of zone ranges in config.tags
 
 	shards map[string]int `bson:"shard"`
 }
@@ -68,12 +89,14 @@ type ConfigMongos struct {
 }
 
 type ConfigShard struct {
-	Chunks  int     `bson:"chunks"`
-	Host    *string `bson:"host"`
-	Jumbo   int     `bson:"jumbo"`
-	ID      *string `bson:"_id"`
-	MaxSize *int    `bson:"maxSize"`
-	State   *int    `bson:"state"`
+	Chunks   int      `bson:"chunks"`
+	Draining *bool    `bson:"draining"`
+	Host     *string  `bson:"host"`
+	Jumbo    int      `bson:"jumbo"`
+	ID       *string  `bson:"_id"`
+	MaxSize  *int     `bson:"maxSize"`
+	State    *int     `bson:"state"`
+	Tags     []string `bson:"tags"` // zones of the shard
 
 	namespaces map[string]int
 }
@@ -92,27 +115,51 @@ type ConfigDB struct {
 	CollectionsMap map[string]ConfigCollection `bson:"collections"`
 	Chunks         []ConfigChunk               `bson:"config.chunks"`
 
-	Actions  *ActionLog          `bson:"actions"`
-	Changes  *ChangeLog          `bson:"changes"`
-	LastPing *primitive.DateTime `bson:"lastPing"`
-	Warnings []string            `bson:"warnings"`
+	MovePrimaryPlan []MovePrimary            `bson:"movePrimaryPlan"`
+	PrimaryShards   []PrimaryShard           `bson:"primaryShards"`
+	QueryAnalyzers  map[string]QueryAnalyzer `bson:"queryAnalyzers"`
+	SplitBursts     []SplitBurst             `bson:"splitBursts"`
+	SplitRates      []SplitRate              `bson:"splitRates"`
+	SplitThreshold  int                      `bson:"splitThreshold"`
+
+	Actions           *ActionLog          `bson:"actions"`
+	Activity          BalancerActivity    `bson:"activity"`
+	BalanceScore      float64             `bson:"balanceScore"`
+	Balancer          BalancerSettings    `bson:"balancer"`
+	BalancerAnomalies []BalancerAnomaly   `bson:"balancerAnomalies"`
+	Changes           *ChangeLog          `bson:"changes"`
+	ChunkSize         int                 `bson:"chunkSize"`
+	Drains            []ShardDrain        `bson:"drains"`
+	LastPing          *primitive.DateTime `bson:"lastPing"`
+	Since             *time.Time          `bson:"since"`
+	TimeZone          string              `bson:"timeZone"`
+	Until             *time.Time          `bson:"until"`
+	Warnings          []string            `bson:"warnings"`
+	WindowTimeZone    string              `bson:"windowTimeZone"`
 
 	IsUpgrade     bool
 	IsUserVersion bool
 	MajorVersion  string
 
-	client       *mongo.Client
-	clusterType  string
-	serverStatus mdb.ServerStatus
-	verbose      bool
+	analyses      *sync.Map // results of analyzeShardKey by namespaces and keys
+	client        *mongo.Client
+	clusterType   string
+	jumboRemedies *sync.Map // remedies of jumbo chunks sized by dataSize by bounds
+	location      *time.Location
+	mergePlans    *sync.Map // merge plans sized by dataSize by namespaces and batches
+	serverStatus  mdb.ServerStatus
+	timeWindows   *timeWindows
+	verbose       bool
+
+	windowLocation *time.Location
 
 	uuid2NS map[string]string
 }
 
 func NewConfigDB(uri string, version string, verbose bool) (*ConfigDB, error) {
 	cfg := ConfigDB{CollectionsMap: map[string]ConfigCollection{}, MongoVersion: version,
-		ShardsMap: map[string]ConfigShard{}, verbose: verbose,
-		uuid2NS: map[string]string{}}
+		ShardsMap: map[string]ConfigShard{}, analyses: &sync.Map{}, jumboRemedies: &sync.Map{}, mergePlans: &sync.Map{},
+		timeWindows: &timeWindows{}, verbose: verbose, uuid2NS: map[string]string{}}
 	cs, err := mdb.ParseURI(uri)
 	if err != nil {
 		return nil, err
@@ -177,6 +224,12 @@ func (ptr *ConfigDB) GetShardingInfo() error {
 	}
 	defer cursor.Close(ctx)
 
+	// get balancer settings
+	log.Println("GetShardingInfo() get balancer settings")
+	if err = db.Collection("settings").FindOne(ctx, bson.D{{Key: "_id", Value: "balancer"}}).Decode(&ptr.Balancer); err != nil {
+		log.Println("check balancer settings", err)
+	}
+
 	// get mongos
 	log.Println("GetShardingInfo() get mongos")
 	opts.SetSort(bson.D{{Key: "ping", Value: -1}})
@@ -235,13 +288,37 @@ func (ptr *ConfigDB) GetShardingInfo() error {
 	if err = ptr.GetChunksInfo(); err != nil {
 		return err
 	}
+	// check zones of collections
+	if err = ptr.GetZones(); err != nil {
+		log.Println("check zones", err)
+	}
+	// check balance of collections
+	if err = ptr.GetBalanceInfo(); err != nil {
+		return err
+	}
+	// check balancer compliance of collections
+	if ptr.isAtLeast(4.4) && ptr.clusterType == mdb.Sharded {
+		ptr.GetBalancerCompliance()
+	}
+	// check shard keys
+	ptr.AssessShardKeys()
+	// check query sampling
+	if ptr.isAtLeast(7.0) {
+		if err = ptr.GetQueryAnalyzers(); err != nil {
+			log.Println("check query analyzers", err)
+		}
+	}
+	// check primary shards
+	if err = ptr.GetPrimaryShardsInfo(); err != nil {
+		return err
+	}
 	return nil
 }
 
 // CheckLogs checks actionlog and changelog
 func (ptr *ConfigDB) CheckLogs() error {
 	log.Println("CheckLogs()")
-	actions, err := NewActionLog(ptr.client)
+	actions, err := NewActionLog(ptr.client, ptr.Since, ptr.Until)
 	if err != nil {
 		return err
 	}
@@ -251,9 +328,13 @@ func (ptr *ConfigDB) CheckLogs() error {
 	if err = actions.GetBalancerRounds(); err != nil {
 		return err
 	}
+	if err = actions.GetRoundErrors(); err != nil {
+		return err
+	}
 	ptr.Actions = actions
+	ptr.GetBalancerAnomalies()
 
-	changes, err := NewChangeLog(ptr.client)
+	changes, err := NewChangeLog(ptr.client, ptr.Since, ptr.Until)
 	if err != nil {
 		return err
 	}
@@ -263,19 +344,187 @@ func (ptr *ConfigDB) CheckLogs() error {
 	if err = changes.GetMoveChunkErrors(); err != nil {
 		return err
 	}
+	if err = changes.GetMigrations(); err != nil {
+		return err
+	}
+	if err = changes.GetChunkDeltas(); err != nil {
+		return err
+	}
+	if err = changes.GetChangeEvents(); err != nil {
+		return err
+	}
+	if err = changes.GetNamespaceSplits(); err != nil {
+		return err
+	}
 	ptr.Changes = changes
+	ptr.GetSplitRates()
+	ptr.CheckBalancerActivity()
+	ptr.GetDrainInfo()
+	return nil
+}
+
+// SetTimeZone sets time zone of time window and charts, e.g. America/New_York
+func (ptr *ConfigDB) SetTimeZone(tz string) error {
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return err
+	}
+	ptr.location = loc
+	ptr.TimeZone = loc.String()
+	return nil
+}
+
+// SetWindowTimeZone sets time zone of the config server primary evaluating the balancer active window
+func (ptr *ConfigDB) SetWindowTimeZone(tz string) error {
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return err
+	}
+	ptr.windowLocation = loc
+	ptr.WindowTimeZone = loc.String()
 	return nil
 }
 
+// GetWindowLocation returns time zone location of the balancer active window, defaults to the time zone
+func (ptr *ConfigDB) GetWindowLocation() *time.Location {
+	if ptr.windowLocation == nil {
+		return ptr.GetLocation()
+	}
+	return ptr.windowLocation
+}
+
+// GetLocation returns time zone location, defaults to UTC
+func (ptr *ConfigDB) GetLocation() *time.Location {
+	if ptr.location == nil {
+		return time.UTC
+	}
+	return ptr.location
+}
+
+// formatTime returns RFC3339 time in the time zone
+func (ptr *ConfigDB) formatTime(t time.Time) string {
+	return t.In(ptr.GetLocation()).Format(time.RFC3339)
+}
+
+// GetWindowQuery returns query parameters of the time window for links, empty if not scoped
+func (ptr *ConfigDB) GetWindowQuery() string {
+	values := url.Values{}
+	if ptr.Since != nil {
+		values.Set("since", ptr.Since.UTC().Format(time.RFC3339))
+	}
+	if ptr.Until != nil {
+		values.Set("until", ptr.Until.UTC().Format(time.RFC3339))
+	}
+	if len(values) == 0 {
+		return ""
+	}
+	return "?" + values.Encode()
+}
+
+// GetTimeWindowConfigDB returns a copy of ConfigDB with logs and findings scoped to [since, until), copies of the
+// most recent MAX_TIME_WINDOWS time windows are cached
+func (ptr *ConfigDB) GetTimeWindowConfigDB(since *time.Time, until *time.Time) (*ConfigDB, error) {
+	if isSameTime(since, ptr.Since) && isSameTime(until, ptr.Until) {
+		return ptr, nil
+	}
+	key := getTimeWindowKey(since) + "/" + getTimeWindowKey(until)
+	if cfg := ptr.timeWindows.get(key); cfg != nil {
+		return cfg, nil
+	}
+	cfg := *ptr
+	cfg.Since, cfg.Until = since, until
+	cfg.IsUpgrade = false
+	cfg.Warnings = nil
+	if err := cfg.CheckLogs(); err != nil {
+		return nil, err
+	}
+	if err := cfg.CheckWarnings(); err != nil {
+		return nil, err
+	}
+	ptr.timeWindows.put(key, &cfg)
+	return &cfg, nil
+}
+
+func getTimeWindowKey(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// timeWindows caches ConfigDB scoped to time windows, the least recently used is evicted
+type timeWindows struct {
+	sync.Mutex
+	configs map[string]*ConfigDB
+	keys    []string // least recently used first
+}
+
+func (ptr *timeWindows) get(key string) *ConfigDB {
+	if ptr == nil {
+		return nil
+	}
+	ptr.Lock()
+	defer ptr.Unlock()
+	cfg, ok := ptr.configs[key]
+	if ok {
+		ptr.touch(key)
+	}
+	return cfg
+}
+
+func (ptr *timeWindows) put(key string, cfg *ConfigDB) {
+	if ptr == nil {
+		return
+	}
+	ptr.Lock()
+	defer ptr.Unlock()
+	if ptr.configs == nil {
+		ptr.configs = map[string]*ConfigDB{}
+	}
+	if _, ok := ptr.configs[key]; !ok && len(ptr.keys) >= MAX_TIME_WINDOWS {
+		delete(ptr.configs, ptr.keys[0])
+		ptr.keys = ptr.keys[1:]
+	}
+	ptr.configs[key] = cfg
+	ptr.touch(key)
+}
+
+// touch moves a key to the most recently used
+func (ptr *timeWindows) touch(key string) {
+	for i, k := range ptr.keys {
+		if k == key {
+			ptr.keys = append(ptr.keys[:i], ptr.keys[i+1:]...)
+			break
+		}
+	}
+	ptr.keys = append(ptr.keys, key)
+}
+
+func isSameTime(a *time.Time, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// isChunksByUUID returns true if config.chunks refers to collections by uuid instead of ns. Since 5.0, collections
+// of config.collections have timestamps and their chunks are by uuid; a 5.0 binary at the 4.4 feature compatibility
+// version keeps chunks by ns.
+func (ptr *ConfigDB) isChunksByUUID() bool {
+	for _, coll := range ptr.CollectionsMap {
+		if coll.Timestamp != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// GetChunksInfo tallies chunks and jumbo chunks by shards and collections
 func (ptr *ConfigDB) GetChunksInfo() error {
 	log.Println("GetChunksInfo()")
 	ctx := context.Background()
 	db := ptr.client.Database("config")
-	var chunk bson.M
-	err := db.Collection("chunks").FindOne(ctx, bson.D{{}}).Decode(&chunk)
-	if err != nil {
-		return err
-	}
+	byUUID := ptr.isChunksByUUID()
 	pipeline := bson.A{
 		bson.D{
 			{Key: "$group", Value: bson.D{
@@ -307,7 +556,7 @@ func (ptr *ConfigDB) GetChunksInfo() error {
 			}},
 		},
 	}
-	if chunk["uuid"] == nil {
+	if !byUUID {
 		pipeline = bson.A{
 			bson.D{
 				{Key: "$group", Value: bson.D{
@@ -359,7 +608,7 @@ func (ptr *ConfigDB) GetChunksInfo() error {
 		if tally.namespaces == nil {
 			tally.namespaces = map[string]int{}
 		}
-		if chunk["uuid"] != nil {
+		if byUUID {
 			doc.NS = ptr.uuid2NS[string(doc.UUID.Data)]
 		}
 		tally.namespaces[doc.NS] += doc.Chunks
@@ -401,8 +650,19 @@ func (ptr *ConfigDB) CheckWarnings() error {
 	 * if # of collections greater than 1,000
 	 * if any mistached major version of mongos instances
 	 * if maxSize is configured in shards
+	 * if any jumbo chunks
 	 * if config.actionlog a capped collection if exists
 	 * if config.changelog a capped collection
+	 * if any shard is an overloaded primary shard
+	 * if any chunk move errors
+	 * if any imbalanced collections
+	 * if any collections have migrations disabled or a chunk size other than the cluster default
+	 * if any collections not balancer compliant
+	 * if any poor shard keys
+	 * if the balancer is stale or idle
+	 * if any draining shard is stuck or needs movePrimary
+	 * if any balancer anomalies
+	 * if any split storms
 	 * if version in the MongoDB required upgrade list
 	 */
 	printer := message.NewPrinter(language.English)
@@ -433,15 +693,26 @@ func (ptr *ConfigDB) CheckWarnings() error {
 			ptr.Warnings = append(ptr.Warnings, printer.Sprintf("Maverick mongos (mismatched major version): %d.", mismatched))
 		}
 	}
-	count := 0
+	count, jumbo := 0, 0
 	for _, shard := range ptr.ShardsMap {
 		if shard.MaxSize != nil {
 			count++
 		}
+		jumbo += shard.Jumbo
 	}
 	if count > 0 {
 		ptr.Warnings = append(ptr.Warnings, printer.Sprintf("%d shards have 'maxSize' configured.", count))
 	}
+	if jumbo > 0 {
+		ptr.Warnings = append(ptr.Warnings, printer.Sprintf("%d chunks are flagged jumbo, see Jumbo Chunks for remedies.", jumbo))
+	}
+
+	for _, primary := range ptr.PrimaryShards {
+		if primary.IsOverloaded {
+			ptr.Warnings = append(ptr.Warnings, printer.Sprintf("Shard %s is the primary shard of %d databases with %s unsharded data, a disproportionate share; see the suggested movePrimary plan.",
+				template.HTMLEscapeString(primary.Shard), len(primary.Databases), gox.GetStorageSize(float64(primary.UnshardedSize))))
+		}
+	}
 
 	if ptr.Actions.Stats.Capped == nil {
 		ptr.Warnings = append(ptr.Warnings, printer.Sprintf("Collection config.actionlog doesn't exist."))
@@ -452,7 +723,125 @@ func (ptr *ConfigDB) CheckWarnings() error {
 		ptr.Warnings = append(ptr.Warnings, printer.Sprintf("Collection config.changelog is not a capped collection."))
 	}
 	if ptr.Changes.Stats.TotalChunkMoveErrors > 0 {
-		ptr.Warnings = append(ptr.Warnings, printer.Sprintf("A total of %d chunk move errors, go evaluate mongod logs and FTDC data.", ptr.Changes.Stats.TotalChunkMoveErrors))
+		top := ptr.Changes.ChunkMoveErrorCategories[0]
+		ptr.Warnings = append(ptr.Warnings, printer.Sprintf("A total of %d chunk move errors, the most common cause is <b>%s</b> (%d errors, %s to %s), see Chunk Move Error Categories.",
+			ptr.Changes.Stats.TotalChunkMoveErrors, top.Category, top.Total,
+			ptr.formatTime(top.First.Time()), ptr.formatTime(top.Last.Time())))
+	}
+	imbalanced, disabled := []string{}, []string{}
+	for ns, coll := range ptr.CollectionsMap {
+		if coll.Balance.IsImbalanced && coll.NoBalance {
+			disabled = append(disabled, ns)
+		} else if coll.Balance.IsImbalanced {
+			imbalanced = append(imbalanced, ns)
+		}
+	}
+	sort.Slice(imbalanced, func(i, j int) bool {
+		return ptr.CollectionsMap[imbalanced[i]].Balance.Score < ptr.CollectionsMap[imbalanced[j]].Balance.Score
+	})
+	sort.Strings(disabled)
+	if len(imbalanced) > 0 {
+		coll := ptr.CollectionsMap[imbalanced[0]]
+		difference := printer.Sprintf("a difference of %d chunks (threshold %d)", coll.Balance.Difference, coll.Balance.Threshold)
+		if coll.Balance.SizeThreshold > 0 {
+			difference = printer.Sprintf("a data size difference of %s (threshold %s)",
+				gox.GetStorageSize(float64(coll.Balance.SizeDifference)), gox.GetStorageSize(float64(coll.Balance.SizeThreshold)))
+		}
+		ptr.Warnings = append(ptr.Warnings, printer.Sprintf("%d sharded collections are imbalanced, the least balanced is <b>%s</b> with %s and a balance score of %.0f%%.",
+			len(imbalanced), template.HTMLEscapeString(coll.GetName()), difference, coll.Balance.Score))
+	}
+	if len(disabled) > 0 {
+		ptr.Warnings = append(ptr.Warnings, printer.Sprintf("%d imbalanced collections have balancing disabled (noBalance), e.g. <b>%s</b>.",
+			len(disabled), template.HTMLEscapeString(GetUserNamespace(disabled[0]))))
+	}
+	frozen, sized := []string{}, []string{}
+	for ns, coll := range ptr.CollectionsMap {
+		if coll.IsMigrationsDisabled() {
+			frozen = append(frozen, ns)
+		}
+		if coll.HasCustomChunkSize(ptr.ChunkSize) {
+			sized = append(sized, ns)
+		}
+	}
+	sort.Strings(frozen)
+	sort.Strings(sized)
+	if len(frozen) > 0 {
+		ptr.Warnings = append(ptr.Warnings, printer.Sprintf("%d sharded collections have migrations disabled (setAllowMigrations), e.g. <b>%s</b>, their chunks can't be balanced or drained.",
+			len(frozen), template.HTMLEscapeString(GetUserNamespace(frozen[0]))))
+	}
+	if len(sized) > 0 {
+		coll := ptr.CollectionsMap[sized[0]]
+		ptr.Warnings = append(ptr.Warnings, printer.Sprintf("%d sharded collections have a chunk size other than the cluster default of %dMB, e.g. <b>%s</b> of %s.",
+			len(sized), ptr.ChunkSize, template.HTMLEscapeString(coll.GetName()), gox.GetStorageSize(float64(coll.MaxChunkSizeBytes))))
+	}
+	violations := []string{}
+	for ns, coll := range ptr.CollectionsMap {
+		if coll.Compliance != nil && !coll.Compliance.BalancerCompliant {
+			violations = append(violations, ns)
+		}
+	}
+	sort.Strings(violations)
+	if len(violations) > 0 {
+		coll := ptr.CollectionsMap[violations[0]]
+		ptr.Warnings = append(ptr.Warnings, printer.Sprintf("%d sharded collections are not balancer compliant per balancerCollectionStatus, e.g. <b>%s</b> (%s).",
+			len(violations), template.HTMLEscapeString(coll.GetName()), template.HTMLEscapeString(coll.Compliance.FirstComplianceViolation)))
+	}
+	poor := []string{}
+	for ns, coll := range ptr.CollectionsMap {
+		if coll.Assessment.Rating == RATING_POOR {
+			poor = append(poor, ns)
+		}
+	}
+	sort.Slice(poor, func(i, j int) bool {
+		if ptr.CollectionsMap[poor[i]].Chunks == ptr.CollectionsMap[poor[j]].Chunks {
+			return poor[i] < poor[j]
+		}
+		return ptr.CollectionsMap[poor[i]].Chunks > ptr.CollectionsMap[poor[j]].Chunks
+	})
+	if len(poor) > 0 {
+		coll := ptr.CollectionsMap[poor[0]]
+		ptr.Warnings = append(ptr.Warnings, printer.Sprintf("%d sharded collections have poor shard keys, e.g. <b>%s</b> %s: %s",
+			len(poor), template.HTMLEscapeString(coll.GetName()), template.HTMLEscapeString(Stringify(coll.GetUserKey())),
+			template.HTMLEscapeString(coll.Assessment.Explanations[0])))
+	}
+	if ptr.Activity.IsStale && ptr.Activity.LastRound == nil {
+		ptr.Warnings = append(ptr.Warnings, printer.Sprintf("Stale balancer: no balancer rounds were found while the balancer is enabled."))
+	} else if ptr.Activity.IsStale {
+		ptr.Warnings = append(ptr.Warnings, printer.Sprintf("Stale balancer: the last balancer round was at %s, %s before the last mongos ping.",
+			ptr.formatTime(*ptr.Activity.LastRound), gox.GetDurationFromSeconds(ptr.LastPing.Time().Sub(*ptr.Activity.LastRound).Seconds())))
+	}
+	if ptr.Activity.IsIdle {
+		ptr.Warnings = append(ptr.Warnings, printer.Sprintf("Idle balancer: balancer rounds moved no chunks while %d collections are imbalanced, e.g. <b>%s</b>.",
+			len(ptr.Activity.Imbalanced), template.HTMLEscapeString(GetUserNamespace(ptr.Activity.Imbalanced[0]))))
+	}
+
+	for _, drain := range ptr.Drains {
+		if drain.IsStuck {
+			ptr.Warnings = append(ptr.Warnings, printer.Sprintf("Draining shard <b>%s</b> appears stuck with %d chunks remaining, %s, see Draining Shards.",
+				template.HTMLEscapeString(drain.Shard), drain.Chunks, drain.Reason))
+		} else if drain.Chunks == 0 && len(drain.Databases) > 0 {
+			ptr.Warnings = append(ptr.Warnings, printer.Sprintf("Draining shard <b>%s</b> has no chunks left, run movePrimary for %d databases to complete removeShard, see the suggested movePrimary plan.",
+				template.HTMLEscapeString(drain.Shard), len(drain.Databases)))
+		}
+	}
+
+	anomalies := map[string]int{}
+	for _, anomaly := range ptr.BalancerAnomalies {
+		if anomalies[anomaly.Kind]++; anomalies[anomaly.Kind] > 1 { // the first time range of a kind
+			continue
+		}
+		ptr.Warnings = append(ptr.Warnings, printer.Sprintf("Balancer anomaly <b>%s</b> from %s to %s, %s, see Balancer Anomalies.",
+			anomaly.Kind, ptr.formatTime(anomaly.Start.Time()), ptr.formatTime(anomaly.End.Time()), anomaly.Detail))
+	}
+
+	bursts := map[string]int{}
+	for _, burst := range ptr.SplitBursts {
+		if bursts[burst.NS]++; bursts[burst.NS] > 1 { // the largest burst of a collection
+			continue
+		}
+		ptr.Warnings = append(ptr.Warnings, printer.Sprintf("Split storm on <b>%s</b>: %d splits from %s to %s, exceeding %d splits in %d minutes, see Chunk Split Rates.",
+			template.HTMLEscapeString(GetUserNamespace(burst.NS)), burst.Total, ptr.formatTime(burst.Start.Time()), ptr.formatTime(burst.End.Time()),
+			ptr.SplitThreshold, int(SPLIT_BURST_WINDOW.Minutes())))
 	}
 
 	str := CheckUpgradeRecommendation(ptr.MongoVersion)
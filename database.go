@@ -0,0 +1,164 @@
+/*
+ * Copyright 2023-present Kuei-chun Chen. All rights reserved.
+ * database.go
+ */
+
+package bond
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/simagix/keyhole/mdb"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type UnshardedCollection struct {
+	Count          int64  `bson:"count"`
+	NS             string `bson:"ns"`
+	Size           int64  `bson:"size"`
+	StorageSize    int64  `bson:"storageSize"`
+	TotalIndexSize int64  `bson:"totalIndexSize"`
+}
+
+type DatabaseInfo struct {
+	ConfigDatabase `bson:",inline"`
+	Collections    []ConfigCollection    `bson:"collections"`
+	IsMongos       bool                  `bson:"isMongos"`
+	Unsharded      []UnshardedCollection `bson:"unsharded"`
+	UnshardedSize  int64                 `bson:"unshardedSize"`
+}
+
+// GetDatabaseInfo returns sharded and, if connected to a mongos, unsharded collections of a database
+func (ptr *ConfigDB) GetDatabaseInfo(name string) (*DatabaseInfo, error) {
+	log.Println("GetDatabaseInfo()", name)
+	var info *DatabaseInfo
+	for _, db := range ptr.Databases {
+		if db.ID == name {
+			info = &DatabaseInfo{ConfigDatabase: db}
+			break
+		}
+	}
+	if info == nil {
+		return nil, fmt.Errorf("database %v not found", name)
+	}
+	prefix := name + "."
+	for ns, coll := range ptr.CollectionsMap {
+		if strings.HasPrefix(ns, prefix) {
+			info.Collections = append(info.Collections, coll)
+		}
+	}
+	sort.Slice(info.Collections, func(i, j int) bool {
+		if info.Collections[i].Chunks == info.Collections[j].Chunks {
+			return info.Collections[i].ID < info.Collections[j].ID
+		}
+		return info.Collections[i].Chunks > info.Collections[j].Chunks
+	})
+
+	if ptr.clusterType != mdb.Sharded {
+		return info, nil
+	}
+	info.IsMongos = true
+	ctx := context.Background()
+	db := ptr.client.Database(name)
+	names, err := db.ListCollectionNames(ctx, bson.D{{Key: "type", Value: "collection"}})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	for _, coll := range names {
+		ns := prefix + coll
+		if strings.HasPrefix(coll, "system.") {
+			continue
+		} else if _, ok := ptr.CollectionsMap[ns]; ok {
+			continue
+		}
+		var doc bson.M
+		if err = db.RunCommand(ctx, bson.D{{Key: "collStats", Value: coll}}).Decode(&doc); err != nil {
+			log.Println("collStats", ns, "error", err)
+			continue
+		}
+		unsharded := UnshardedCollection{NS: ns, Count: ToInt64(doc["count"]), Size: ToInt64(doc["size"]),
+			StorageSize: ToInt64(doc["storageSize"]), TotalIndexSize: ToInt64(doc["totalIndexSize"])}
+		info.Unsharded = append(info.Unsharded, unsharded)
+		info.UnshardedSize += unsharded.Size
+	}
+	sort.Slice(info.Unsharded, func(i, j int) bool {
+		return info.Unsharded[i].Size > info.Unsharded[j].Size
+	})
+	return info, nil
+}
+
+// GetDatabaseTemplate returns HTML
+func GetDatabaseTemplate() (*template.Template, error) {
+	html := GetContentHTML()
+	html += DatabaseInfoHTML + DatabaseCollectionsHTML + UnshardedCollectionsHTML
+	html += "</body></html>"
+	return template.New("bond").Funcs(infoFuncMap()).Parse(html)
+}
+
+const (
+	// database summary
+	DatabaseInfoHTML = `<div style='float: left; clear: left;'>
+		<table width=400px><caption>Database {{.Database.ID}}</caption><tr><th>Metric</th><th>Value</th>
+			<tr><td align='left' class='rowtitle'>Primary Shard</td><td align='left' class='break'>{{ .Database.Primary }}</td></tr>
+			<tr><td align='left' class='rowtitle'>Partitioned</td><td align='center' class='break'>{{ getCheckMarkSymbol .Database.Partitioned }}</td></tr>
+			<tr><td align='left' class='rowtitle'>Number of Sharded Collections</td><td align='right' class='break'>{{ numPrinter (len .Database.Collections) }}</td></tr>
+		{{if .Database.IsMongos}}
+			<tr><td align='left' class='rowtitle'>Number of Unsharded Collections</td><td align='right' class='break'>{{ numPrinter (len .Database.Unsharded) }}</td></tr>
+			<tr><td align='left' class='rowtitle'>Unsharded Data Size on {{ .Database.Primary }}</td><td align='right' class='break'>{{ getStorageSize .Database.UnshardedSize }}</td></tr>
+		{{else}}
+			<tr><td align='left' class='rowtitle'>Unsharded Collections</td><td align='left' class='break'>available when connected to a mongos</td></tr>
+		{{end}}
+		</table></div>`
+
+	// sharded collections of a database
+	DatabaseCollectionsHTML = `
+{{if gt (len .Database.Collections) 0}}
+	<div style='float: left;'>
+	{{$q:=.CollectionsTable}}
+	<table><caption>Sharded Collections ({{numPrinter $q.Total}})</caption><tr><th>#</th>
+	{{sortHeader $q "_id" "Collection Name"}}{{sortHeader $q "key" "Shard Key"}}{{sortHeader $q "unique" "Unique"}}{{sortHeader $q "noBalance" "No Balance"}}{{sortHeader $q "chunks" "Chunks"}}{{sortHeader $q "balance" "Balance"}}{{sortHeader $q "compliant" "Compliant"}}<th>-</th>
+	{{range $n, $value := .Collections}}
+			<tr>
+				<td align='right' class='break'>{{ add $q.Start (add $n 1) }}</td>
+				<td align='left' class='break'><a href='{{pathURL "/bond/collections/" $value.ID}}'>{{ $value.GetName }}</a>{{if $value.IsTimeseries}} <i class='fa fa-clock-o' title='time-series buckets {{$value.ID}}'></i>{{end}}{{if $value.IsMigrationsDisabled}} <i class='fa fa-ban' style='color:red;' title='migrations disabled'></i>{{end}}{{if $value.HasCustomChunkSize $.Config.ChunkSize}} <span title='chunk size differs from the cluster default of {{$.Config.ChunkSize}}MB'>({{ getStorageSize $value.MaxChunkSizeBytes }})</span>{{end}}</td>
+				<td align='left' class='break'><span title='shard key rated {{$value.Assessment.Rating}}'>{{ stringify $value.GetUserKey }}</span> {{getWarningSymbol (ne $value.Assessment.Rating "poor") }}</td>
+				<td align='center' class='break'>{{ getCheckMarkSymbol $value.Unique }}</td>
+				<td align='center' class='break'>{{ getCheckMarkSymbol $value.NoBalance }}</td>
+				<td align='right' class='break'>{{ numPrinter $value.Chunks }}</td>
+				<td align='right' class='break'>{{ printf "%.0f%%" $value.Balance.Score }} {{getWarningSymbol (not $value.Balance.IsImbalanced) }}</td>
+				<td align='center' class='break'>{{if $value.Compliance}}{{if $value.Compliance.BalancerCompliant}}{{getCheckMarkSymbol true}}{{else}}{{ $value.Compliance.FirstComplianceViolation }} {{getWarningSymbol false}}{{end}}{{else}}-{{end}}</td>
+				<td align='center'><a class='btn' href='{{pathURL "/bond/chart/namespaces/" $value.ID}}'>
+					<i class='fa fa-pie-chart' style='font-size: .8em;'></i></a></td>
+			</tr>
+	{{end}}
+	</table>
+	{{tablePager $q}}</div>
+{{end}}`
+
+	// unsharded collections of a database, all on the primary shard
+	UnshardedCollectionsHTML = `
+{{if gt (len .Database.Unsharded) 0}}
+	<div style='float: left;'>
+	{{$q:=.UnshardedTable}}
+	<table><caption>Unsharded Collections on {{ .Database.Primary }} ({{numPrinter $q.Total}})</caption><tr><th>#</th>
+	{{sortHeader $q "ns" "Collection Name"}}{{sortHeader $q "count" "Documents"}}{{sortHeader $q "size" "Data Size"}}{{sortHeader $q "storageSize" "Storage Size"}}{{sortHeader $q "totalIndexSize" "Index Size"}}
+	{{range $n, $value := .Unsharded}}
+			<tr>
+				<td align='right' class='break'>{{ add $q.Start (add $n 1) }}</td>
+				<td align='left' class='break'>{{ getUserNamespace $value.NS }}</td>
+				<td align='right' class='break'>{{ numPrinter $value.Count }}</td>
+				<td align='right' class='break'>{{ getStorageSize $value.Size }}</td>
+				<td align='right' class='break'>{{ getStorageSize $value.StorageSize }}</td>
+				<td align='right' class='break'>{{ getStorageSize $value.TotalIndexSize }}</td>
+			</tr>
+	{{end}}
+	</table>
+	{{tablePager $q}}</div>
+{{end}}`
+)
@@ -0,0 +1,201 @@
+/*
+ * Copyright 2023-present Kuei-chun Chen. All rights reserved.
+ * drain.go
+ */
+
+package bond
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/simagix/gox"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	DRAIN_RATE_WINDOW = 6 * time.Hour // recent migrations measuring the drain rate
+	DRAIN_STUCK_AFTER = time.Hour     // in window time since the last migration off a stuck draining shard
+)
+
+// DrainCollection is remaining chunks of a collection on a draining shard
+type DrainCollection struct {
+	Chunks    int    `bson:"chunks"`
+	NoBalance bool   `bson:"noBalance"`
+	NS        string `bson:"ns"`
+	Shard     string `bson:"shard"`
+}
+
+// ShardDrain is progress of a shard being removed, rate is chunks migrated off the shard per hour
+type ShardDrain struct {
+	Chunks        int               `bson:"chunks"`
+	Collections   []DrainCollection `bson:"collections"`
+	Databases     []string          `bson:"databases"`
+	ETA           time.Duration     `bson:"eta"`
+	IsStuck       bool              `bson:"isStuck"`
+	Jumbo         int               `bson:"jumbo"`
+	LastMigration *time.Time        `bson:"lastMigration"`
+	Rate          float64           `bson:"rate"`
+	Reason        string            `bson:"reason"`
+	Shard         string            `bson:"shard"`
+}
+
+// IsDraining returns true if removeShard started draining the shard
+func (ptr ConfigShard) IsDraining() bool {
+	return ptr.Draining != nil && *ptr.Draining
+}
+
+// GetETA returns estimated time to drain remaining chunks, empty if no recent migrations
+func (ptr *ShardDrain) GetETA() string {
+	if ptr.Chunks == 0 {
+		return "drained"
+	} else if ptr.Rate == 0 {
+		return ""
+	}
+	return gox.GetDurationFromSeconds(ptr.ETA.Seconds())
+}
+
+// GetDrainInfo tracks draining shards, remaining chunks by collections, databases needing movePrimary, and the
+// drain rate from successful migrations off the shard within DRAIN_RATE_WINDOW of the analyzed time window. A
+// drain is stuck if chunks remain and no migrations committed within DRAIN_STUCK_AFTER of the active window.
+func (ptr *ConfigDB) GetDrainInfo() {
+	log.Println("GetDrainInfo()")
+	ptr.Drains = nil
+	names := []string{}
+	for name, shard := range ptr.ShardsMap {
+		if shard.IsDraining() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	now := time.Now()
+	if ptr.Until != nil {
+		now = *ptr.Until
+	} else if ptr.LastPing != nil {
+		now = ptr.LastPing.Time()
+	}
+	for _, name := range names {
+		shard := ptr.ShardsMap[name]
+		drain := ShardDrain{Jumbo: shard.Jumbo, Shard: name}
+		for ns, coll := range ptr.CollectionsMap {
+			if chunks := coll.shards[name]; chunks > 0 {
+				drain.Chunks += chunks
+				drain.Collections = append(drain.Collections, DrainCollection{Chunks: chunks, NoBalance: coll.NoBalance, NS: ns, Shard: name})
+			}
+		}
+		sort.Slice(drain.Collections, func(i, j int) bool {
+			if drain.Collections[i].Chunks == drain.Collections[j].Chunks {
+				return drain.Collections[i].NS < drain.Collections[j].NS
+			}
+			return drain.Collections[i].Chunks > drain.Collections[j].Chunks
+		})
+		for _, primary := range ptr.PrimaryShards {
+			if primary.Shard == name {
+				drain.Databases = primary.Databases
+			}
+		}
+
+		var moved int
+		if ptr.Changes != nil {
+			for _, migration := range ptr.Changes.Migrations {
+				t := migration.Time.Time()
+				if migration.Success && migration.From == name && !t.After(now) && now.Sub(t) <= DRAIN_RATE_WINDOW {
+					moved++
+				}
+			}
+		}
+		from := now.Add(-DRAIN_RATE_WINDOW)
+		if ptr.Since != nil && ptr.Since.After(from) {
+			from = *ptr.Since
+		}
+		if hours := ptr.getInWindowDuration(from, now).Hours(); hours > 0 {
+			drain.Rate = float64(moved) / hours
+		}
+		if drain.Rate > 0 {
+			drain.ETA = time.Duration(float64(drain.Chunks) / drain.Rate * float64(time.Hour))
+		}
+		var err error
+		if drain.LastMigration, err = ptr.getLastMigrationFrom(name); err != nil {
+			log.Println("check last migration from", name, err)
+		}
+
+		if drain.Chunks > 0 {
+			if !ptr.Balancer.IsEnabled() {
+				drain.IsStuck, drain.Reason = true, "the balancer is disabled"
+			} else if drain.LastMigration == nil {
+				drain.IsStuck, drain.Reason = true, "no chunks were migrated off the shard"
+			} else if ptr.getInWindowDuration(*drain.LastMigration, now) >= DRAIN_STUCK_AFTER {
+				drain.IsStuck = true
+				drain.Reason = fmt.Sprintf("no chunks were migrated off the shard since %v", ptr.formatTime(*drain.LastMigration))
+			}
+			if drain.IsStuck && drain.Jumbo > 0 {
+				drain.Reason += fmt.Sprintf(", %d jumbo chunks may block the drain", drain.Jumbo)
+			}
+		}
+		ptr.Drains = append(ptr.Drains, drain)
+	}
+}
+
+// getLastMigrationFrom returns time of the latest migration committed off a shard regardless of the time window
+func (ptr *ConfigDB) getLastMigrationFrom(shard string) (*time.Time, error) {
+	var doc struct {
+		Time time.Time `bson:"time"`
+	}
+	opts := options.FindOne().SetSort(bson.D{{Key: "time", Value: -1}}).SetProjection(bson.D{{Key: "time", Value: 1}})
+	err := ptr.client.Database("config").Collection("changelog").FindOne(context.Background(),
+		bson.D{{Key: "what", Value: "moveChunk.commit"}, {Key: "details.from", Value: shard}}, opts).Decode(&doc)
+	if err != nil {
+		return nil, err
+	}
+	return &doc.Time, nil
+}
+
+// GetDrainCollectionsPage returns a page of remaining chunks of collections on draining shards
+func GetDrainCollectionsPage(r *http.Request, drains []ShardDrain) ([]DrainCollection, *TableQuery) {
+	colls := []DrainCollection{}
+	for _, drain := range drains {
+		colls = append(colls, drain.Collections...)
+	}
+	q := NewTableQuery(r, "drainColls", "chunks", true)
+	docs := []DrainCollection{}
+	for _, i := range q.Apply(len(colls), func(i int) string { return colls[i].NS },
+		map[string]func(int) interface{}{
+			"ns":        func(i int) interface{} { return colls[i].NS },
+			"shard":     func(i int) interface{} { return colls[i].Shard },
+			"chunks":    func(i int) interface{} { return colls[i].Chunks },
+			"noBalance": func(i int) interface{} { return colls[i].NoBalance },
+		}) {
+		docs = append(docs, colls[i])
+	}
+	return docs, q
+}
+
+// GetDrainsPage returns a page of draining shards
+func GetDrainsPage(r *http.Request, drains []ShardDrain) ([]ShardDrain, *TableQuery) {
+	q := NewTableQuery(r, "drains", "chunks", true)
+	docs := []ShardDrain{}
+	for _, i := range q.Apply(len(drains), func(i int) string { return drains[i].Shard },
+		map[string]func(int) interface{}{
+			"shard":       func(i int) interface{} { return drains[i].Shard },
+			"chunks":      func(i int) interface{} { return drains[i].Chunks },
+			"jumbo":       func(i int) interface{} { return drains[i].Jumbo },
+			"collections": func(i int) interface{} { return len(drains[i].Collections) },
+			"databases":   func(i int) interface{} { return len(drains[i].Databases) },
+			"rate":        func(i int) interface{} { return drains[i].Rate },
+			"eta":         func(i int) interface{} { return int64(drains[i].ETA) },
+			"lastMigration": func(i int) interface{} {
+				if drains[i].LastMigration == nil {
+					return int64(0)
+				}
+				return drains[i].LastMigration.Unix()
+			},
+		}) {
+		docs = append(docs, drains[i])
+	}
+	return docs, q
+}
@@ -0,0 +1,188 @@
+/*
+ * Copyright 2023-present Kuei-chun Chen. All rights reserved.
+ * errors.go
+ */
+
+package bond
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	ERR_ABORTED          = "Aborted or Interrupted"
+	ERR_CHUNK_NOT_FOUND  = "Chunk Not Found"
+	ERR_CONFLICT         = "Conflicting Operation"
+	ERR_CRITICAL_SECTION = "Critical Section Timeout"
+	ERR_JUMBO_CHUNK      = "Jumbo Chunk"
+	ERR_LOCK_TIMEOUT     = "Lock Timeout"
+	ERR_NETWORK          = "Network Error"
+	ERR_OTHER            = "Other"
+	ERR_RANGE_DELETION   = "Range Deletion Pending"
+	ERR_STALE_CONFIG     = "Stale Config"
+	ERR_TIMEOUT          = "Operation Timeout"
+	ERR_WRITE_CONCERN    = "Write Concern"
+)
+
+// errorCodes maps server error codes to categories
+var errorCodes = map[int]string{
+	6:     ERR_NETWORK,       // HostUnreachable
+	7:     ERR_NETWORK,       // HostNotFound
+	24:    ERR_LOCK_TIMEOUT,  // LockTimeout
+	46:    ERR_LOCK_TIMEOUT,  // LockBusy
+	50:    ERR_TIMEOUT,       // MaxTimeMSExpired
+	63:    ERR_STALE_CONFIG,  // StaleShardVersion
+	64:    ERR_WRITE_CONCERN, // WriteConcernFailed
+	89:    ERR_NETWORK,       // NetworkTimeout
+	91:    ERR_ABORTED,       // ShutdownInProgress
+	117:   ERR_CONFLICT,      // ConflictingOperationInProgress
+	150:   ERR_STALE_CONFIG,  // StaleEpoch
+	202:   ERR_NETWORK,       // NetworkInterfaceExceededTimeLimit
+	262:   ERR_TIMEOUT,       // ExceededTimeLimit
+	279:   ERR_NETWORK,       // ClientDisconnect
+	309:   ERR_JUMBO_CHUNK,   // ChunkTooBig
+	9001:  ERR_NETWORK,       // SocketException
+	11600: ERR_ABORTED,       // InterruptedAtShutdown
+	11601: ERR_ABORTED,       // Interrupted
+	11602: ERR_ABORTED,       // InterruptedDueToReplStateChange
+	13388: ERR_STALE_CONFIG,  // StaleConfig
+}
+
+// errorPatterns are checked in order, the first match wins
+var errorPatterns = []struct {
+	category string
+	re       *regexp.Regexp
+}{
+	{ERR_CRITICAL_SECTION, regexp.MustCompile(`(?i)critical section`)},
+	{ERR_RANGE_DELETION, regexp.MustCompile(`(?i)range delet|rangeDeletions|overlapping range|pending delet|orphan|still being deleted`)},
+	{ERR_JUMBO_CHUNK, regexp.MustCompile(`(?i)jumbo|chunk too big|ChunkTooBig|too many documents|exceeds the maximum|exceeds.*chunk size`)},
+	{ERR_LOCK_TIMEOUT, regexp.MustCompile(`(?i)lock.*(timeout|timed out|busy)|LockTimeout|LockBusy|could not acquire|distributed lock`)},
+	{ERR_TIMEOUT, regexp.MustCompile(`(?i)MaxTimeMSExpired|operation exceeded time limit`)},
+	{ERR_NETWORK, regexp.MustCompile(`(?i)network|HostUnreachable|HostNotFound|SocketException|connection (refused|reset|closed)|NetworkTimeout|couldn't connect|failed to connect`)},
+	{ERR_CONFLICT, regexp.MustCompile(`(?i)ConflictingOperationInProgress|another migration|already in progress|migration already`)},
+	{ERR_STALE_CONFIG, regexp.MustCompile(`(?i)StaleConfig|stale config|version mismatch|epoch`)},
+	{ERR_WRITE_CONCERN, regexp.MustCompile(`(?i)write ?concern|waiting for replication|majority`)},
+	{ERR_CHUNK_NOT_FOUND, regexp.MustCompile(`(?i)is not a chunk|chunk not found|can't find chunk|no chunk found`)},
+	{ERR_ABORTED, regexp.MustCompile(`(?i)abort|interrupt|killed|cancel|shutdown`)},
+}
+
+// messageTokens are variable parts of error messages, replaced in order
+var messageTokens = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	{regexp.MustCompile(`ObjectId\('?[a-fA-F0-9]{24}'?\)|\b[a-fA-F0-9]{24}\b`), "<oid>"},
+	{regexp.MustCompile(`\b[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}\b`), "<uuid>"},
+	{regexp.MustCompile(`"[^"]*"|'[^']*'`), "<str>"},
+	{regexp.MustCompile(`[\w.-]+:\d{2,5}\b`), "<host>"},
+	{regexp.MustCompile(`\d+(\.\d+)?`), "<n>"},
+}
+
+var documentRe = regexp.MustCompile(`\{[^{}]*\}`)
+
+// NormalizeErrorMessage replaces variable parts of an error message, e.g. ids, hosts, numbers, and chunk bounds
+func NormalizeErrorMessage(errmsg string) string {
+	if errmsg == "" {
+		return "(no error message)"
+	}
+	for _, token := range messageTokens {
+		errmsg = token.re.ReplaceAllString(errmsg, token.repl)
+	}
+	for prev := ""; prev != errmsg; { // collapse nested documents
+		prev = errmsg
+		errmsg = documentRe.ReplaceAllString(errmsg, "<doc>")
+	}
+	return errmsg
+}
+
+// ErrorCategory summarizes errors of a category
+type ErrorCategory struct {
+	Category   string             `bson:"category"`
+	Example    string             `bson:"example"`
+	First      primitive.DateTime `bson:"first"`
+	Last       primitive.DateTime `bson:"last"`
+	Namespaces []string           `bson:"namespaces"`
+	Total      int                `bson:"total"`
+}
+
+// GetErrorCategory returns the category of an error from its code or message
+func GetErrorCategory(code int, errmsg string) string {
+	if category, ok := errorCodes[code]; ok {
+		return category
+	}
+	if errmsg == "" {
+		return ERR_OTHER
+	}
+	for _, pattern := range errorPatterns {
+		if pattern.re.MatchString(errmsg) {
+			return pattern.category
+		}
+	}
+	return ERR_OTHER
+}
+
+// AddErrorCategory adds errors to categories by key, namespace is optional
+func AddErrorCategory(categories map[string]*ErrorCategory, key string, category string, errmsg string, ns string,
+	total int, first primitive.DateTime, last primitive.DateTime) {
+	tally, ok := categories[key]
+	if !ok {
+		tally = &ErrorCategory{Category: category, Example: errmsg, First: first, Last: last}
+		categories[key] = tally
+	}
+	tally.Total += total
+	if tally.Example == "" {
+		tally.Example = errmsg
+	}
+	if first < tally.First {
+		tally.First = first
+	}
+	if last > tally.Last {
+		tally.Last = last
+	}
+	if ns == "" {
+		return
+	}
+	for _, name := range tally.Namespaces {
+		if name == ns {
+			return
+		}
+	}
+	tally.Namespaces = append(tally.Namespaces, ns)
+	sort.Strings(tally.Namespaces)
+}
+
+// GetErrorCategories returns categories ordered by totals
+func GetErrorCategories(categories map[string]*ErrorCategory) []ErrorCategory {
+	list := []ErrorCategory{}
+	for _, category := range categories {
+		list = append(list, *category)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Total == list[j].Total {
+			return list[i].Category < list[j].Category
+		}
+		return list[i].Total > list[j].Total
+	})
+	return list
+}
+
+// GetErrorCategoriesPage returns a page of error categories
+func GetErrorCategoriesPage(r *http.Request, name string, categories []ErrorCategory) ([]ErrorCategory, *TableQuery) {
+	q := NewTableQuery(r, name, "total", true)
+	docs := []ErrorCategory{}
+	for _, i := range q.Apply(len(categories), func(i int) string { return categories[i].Category },
+		map[string]func(int) interface{}{
+			"category":   func(i int) interface{} { return categories[i].Category },
+			"total":      func(i int) interface{} { return categories[i].Total },
+			"namespaces": func(i int) interface{} { return len(categories[i].Namespaces) },
+			"first":      func(i int) interface{} { return int64(categories[i].First) },
+			"last":       func(i int) interface{} { return int64(categories[i].Last) },
+		}) {
+		docs = append(docs, categories[i])
+	}
+	return docs, q
+}
@@ -0,0 +1,67 @@
+/*
+ * Copyright 2023-present Kuei-chun Chen. All rights reserved.
+ * errors_test.go
+ */
+
+package bond
+
+import "testing"
+
+func TestGetErrorCategory(t *testing.T) {
+	tests := []struct {
+		code     int
+		errmsg   string
+		category string
+	}{
+		{6, "", ERR_NETWORK},
+		{11, "", ERR_OTHER}, // UserNotFound
+		{24, "", ERR_LOCK_TIMEOUT},
+		{46, "", ERR_LOCK_TIMEOUT},
+		{50, "", ERR_TIMEOUT},
+		{64, "waiting for replication timed out", ERR_WRITE_CONCERN},
+		{117, "", ERR_CONFLICT},
+		{262, "", ERR_TIMEOUT},
+		{309, "", ERR_JUMBO_CHUNK},
+		{11601, "", ERR_ABORTED},
+		{13388, "", ERR_STALE_CONFIG},
+		{50, "operation exceeded time limit while waiting for the distributed lock", ERR_TIMEOUT}, // code first
+		{0, "", ERR_OTHER},
+		{0, "unknown failure", ERR_OTHER},
+		{0, "moveChunk failed to engage TO-shard in the data transfer: critical section timed out", ERR_CRITICAL_SECTION},
+		{0, "Chunk move was not successful due to range deletion of overlapping range pending", ERR_RANGE_DELETION},
+		{0, "chunk too big to move", ERR_JUMBO_CHUNK},
+		{0, "could not acquire collection lock for db.coll to migrate chunk: LockTimeout", ERR_LOCK_TIMEOUT},
+		{0, "operation exceeded time limit", ERR_TIMEOUT},
+		{0, "MaxTimeMSExpired: waiting for the migration", ERR_TIMEOUT},
+		{0, "HostUnreachable: connection refused", ERR_NETWORK},
+		{0, "ConflictingOperationInProgress: another migration is running", ERR_CONFLICT},
+		{0, "StaleConfig: version mismatch detected", ERR_STALE_CONFIG},
+		{0, "is not a chunk of db.coll", ERR_CHUNK_NOT_FOUND},
+		{0, "migration aborted", ERR_ABORTED},
+	}
+	for _, tc := range tests {
+		if category := GetErrorCategory(tc.code, tc.errmsg); category != tc.category {
+			t.Errorf("GetErrorCategory(%d, %q) = %q, want %q", tc.code, tc.errmsg, category, tc.category)
+		}
+	}
+}
+
+func TestNormalizeErrorMessage(t *testing.T) {
+	tests := []struct {
+		errmsg string
+		want   string
+	}{
+		{"", "(no error message)"},
+		{"aborted", "aborted"},
+		{"migration 64f1a2b3c4d5e6f7a8b9c0d1 failed", "migration <oid> failed"},
+		{"session 0f8fad5b-d9cb-469f-a165-70867728950e expired", "session <uuid> expired"},
+		{"cannot connect to shard01.example.com:27018 after 3 attempts", "cannot connect to <host> after <n> attempts"},
+		{`chunk of "db.coll" is too big`, "chunk of <str> is too big"},
+		{"bounds { _id: { a: 1 } } to { _id: MaxKey } of 1.5MB", "bounds <doc> to <doc> of <n>MB"},
+	}
+	for _, tc := range tests {
+		if got := NormalizeErrorMessage(tc.errmsg); got != tc.want {
+			t.Errorf("NormalizeErrorMessage(%q) = %q, want %q", tc.errmsg, got, tc.want)
+		}
+	}
+}
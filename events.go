@@ -0,0 +1,116 @@
+/*
+ * Copyright 2023-present Kuei-chun Chen. All rights reserved.
+ * events.go
+ */
+
+package bond
+
+import (
+	"context"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ChangeEventTypes are DDL and topology events of config.changelog, events are logged as a type or with
+// suffixes, e.g. shardCollection.start and shardCollection.end
+var ChangeEventTypes = []string{"addShard", "dropCollection", "dropDatabase", "movePrimary", "refineCollectionShardKey",
+	"removeShard", "renameCollection", "reshardCollection", "shardCollection"}
+
+// ChangeEvent is a DDL or topology event
+type ChangeEvent struct {
+	Details bson.M             `bson:"details"`
+	NS      string             `bson:"ns"`
+	Server  string             `bson:"server"`
+	Time    primitive.DateTime `bson:"time"`
+	Type    string             `bson:"type"`
+	What    string             `bson:"what"`
+}
+
+// GetChangeEvents returns DDL and topology events in time order
+func (ptr *ChangeLog) GetChangeEvents() error {
+	log.Println("ChangeLog.GetChangeEvents()")
+	filter := bson.D{
+		{Key: "what", Value: primitive.Regex{Pattern: "^(" + strings.Join(ChangeEventTypes, "|") + `)(\.|$)`}},
+		{Key: "time", Value: GetTimeRangeFilter(ptr.since, ptr.until)},
+	}
+	ctx := context.Background()
+	db := ptr.client.Database("config")
+	opts := options.Find().SetSort(bson.D{{Key: "time", Value: 1}})
+	cursor, err := db.Collection("changelog").Find(ctx, filter, opts)
+	if err != nil {
+		return err
+	}
+	for cursor.Next(ctx) {
+		var doc ChangeEvent
+		cursor.Decode(&doc)
+		doc.Type = strings.Split(doc.What, ".")[0]
+		ptr.ChangeEvents = append(ptr.ChangeEvents, doc)
+	}
+	defer cursor.Close(ctx)
+	return nil
+}
+
+// GetChangeEventsPage returns a page of events of a type, all types if the events.type parameter is empty
+func GetChangeEventsPage(r *http.Request, events []ChangeEvent) ([]ChangeEvent, *TableQuery) {
+	eventType := r.URL.Query().Get("events.type")
+	filtered := []ChangeEvent{}
+	for _, event := range events {
+		if eventType == "" || event.Type == eventType {
+			filtered = append(filtered, event)
+		}
+	}
+	q := NewTableQuery(r, "events", "time", true)
+	docs := []ChangeEvent{}
+	for _, i := range q.Apply(len(filtered), func(i int) string { return filtered[i].NS },
+		map[string]func(int) interface{}{
+			"time":   func(i int) interface{} { return int64(filtered[i].Time) },
+			"what":   func(i int) interface{} { return filtered[i].What },
+			"ns":     func(i int) interface{} { return filtered[i].NS },
+			"server": func(i int) interface{} { return filtered[i].Server },
+		}) {
+		docs = append(docs, filtered[i])
+	}
+	return docs, q
+}
+
+// GetEventsTemplate returns HTML of DDL and topology events
+func GetEventsTemplate() (*template.Template, error) {
+	html := GetContentHTML()
+	html += EventsHTML
+	html += "</body></html>"
+	return template.New("bond").Funcs(infoFuncMap()).Parse(html)
+}
+
+const (
+	// DDL and topology events
+	EventsHTML = `<div style='float: left; clear: left;'>
+	{{$q:=.EventsTable}}
+	<table><caption>DDL and Topology Events ({{numPrinter $q.Total}})</caption>
+	<tr><td colspan='6' align='left'>
+		<select style="margin: 0px 0px; padding: 0px 0px; font-size: 1em" onchange="setQueryParam('events.type', this.value)">
+			<option value=''>all events</option>
+		{{range $v := .EventTypes}}
+			<option value='{{$v}}'{{if eq $v $.EventType}} selected{{end}}>{{$v}}</option>
+		{{end}}
+		</select></td></tr>
+	<tr><th>#</th>
+	{{sortHeader $q "time" "Time"}}{{sortHeader $q "what" "Event"}}{{sortHeader $q "ns" "Namespace"}}{{sortHeader $q "server" "Server"}}<th>Details</th>
+	{{range $n, $value := .Events}}
+			<tr>
+				<td align='right' class='break'>{{ add $q.Start (add $n 1) }}</td>
+				<td align='left' class='break'>{{ ISODate $value.Time }}</td>
+				<td align='left' class='break'>{{ $value.What }}</td>
+				<td align='left' class='break'>{{ getUserNamespace $value.NS }}</td>
+				<td align='left' class='break'>{{ $value.Server }}</td>
+				<td align='left' class='break'>{{ stringify $value.Details }}</td>
+			</tr>
+	{{end}}
+	</table>
+	{{tablePager $q}}</div>`
+)
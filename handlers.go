@@ -10,14 +10,19 @@ import (
 	"fmt"
 	"net/http"
 	"sort"
+	"strconv"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 )
 
 const (
-	T_MIGRATION_TIME  = "migration_time"
-	T_MIGRATION_STATS = "migration_stats"
-	T_CHUNK_SPLITS    = "splits"
+	T_MIGRATION_TIME    = "migration_time"
+	T_MIGRATION_STATS   = "migration_stats"
+	T_CHUNK_SPLITS      = "splits"
+	T_MIGRATION_LATENCY = "migration_latency"
+	T_MIGRATION_STEPS   = "migration_steps"
+	T_CHUNK_OWNERSHIP   = "chunk_ownership"
 )
 
 type Chart struct {
@@ -35,6 +40,52 @@ var charts = map[string]Chart{
 		"Display average migration time", "/bond/charts/" + T_MIGRATION_STATS},
 	T_CHUNK_SPLITS: {3, "No. of Chunk Splits",
 		"Display chunk splits", "/bond/charts/" + T_CHUNK_SPLITS},
+	T_MIGRATION_LATENCY: {4, "Chunk Migration Latency",
+		"Display average and maximum chunk migration time", "/bond/charts/" + T_MIGRATION_LATENCY},
+	T_MIGRATION_STEPS: {5, "Chunk Migration Step Times",
+		"Display average clone, catch-up, critical section, and commit time", "/bond/charts/" + T_MIGRATION_STEPS},
+	T_CHUNK_OWNERSHIP: {6, "Chunks per Shard",
+		"Display number of chunks by shards over time", "/bond/charts/" + T_CHUNK_OWNERSHIP},
+}
+
+var chartTypes = map[string]string{
+	"area":    "AreaChart",
+	"column":  "ColumnChart",
+	"line":    "LineChart",
+	"stepped": "SteppedAreaChart",
+}
+
+// ChartOptions holds chart options from query parameters, e.g. ?type=line&height=640&granularity=day&tz=UTC
+type ChartOptions struct {
+	ChartType   string
+	Granularity string
+	Height      int
+	NS          string
+	Since       string
+	TimeZone    string
+	Type        string
+	Until       string
+}
+
+// GetChartOptions returns chart options from query parameters
+func GetChartOptions(r *http.Request) ChartOptions {
+	values := r.URL.Query()
+	opts := ChartOptions{ChartType: chartTypes["column"], Granularity: GRANULARITY_AUTO, Height: 480,
+		NS: values.Get("ns"), Since: values.Get("since"), TimeZone: values.Get("tz"), Type: "column", Until: values.Get("until")}
+	if opts.TimeZone == "" {
+		opts.TimeZone = GetConfigDB().TimeZone
+	}
+	if granularity := values.Get("granularity"); granularity != "" {
+		opts.Granularity = granularity
+	}
+	if value, ok := chartTypes[values.Get("type")]; ok {
+		opts.ChartType = value
+		opts.Type = values.Get("type")
+	}
+	if height := ToInt(values.Get("height")); height >= 200 && height <= 2000 {
+		opts.Height = height
+	}
+	return opts
 }
 
 type NameValue struct {
@@ -42,35 +93,137 @@ type NameValue struct {
 	Value int    `bson:"value"`
 }
 
+// GetRequestConfigDB returns ConfigDB scoped to the since and until query parameters if given
+func GetRequestConfigDB(r *http.Request) (*ConfigDB, error) {
+	config := GetConfigDB()
+	values := r.URL.Query()
+	if !values.Has("since") && !values.Has("until") {
+		return config, nil
+	}
+	loc, err := GetRequestLocation(r)
+	if err != nil {
+		return nil, err
+	}
+	since, err := ParseTime(values.Get("since"), loc)
+	if err != nil {
+		return nil, err
+	}
+	until, err := ParseTime(values.Get("until"), loc)
+	if err != nil {
+		return nil, err
+	}
+	return config.GetTimeWindowConfigDB(since, until)
+}
+
+// GetRequestLocation returns time zone from the tz query parameter, defaults to the -tz flag
+func GetRequestLocation(r *http.Request) (*time.Location, error) {
+	if tz := r.URL.Query().Get("tz"); tz != "" {
+		return time.LoadLocation(tz)
+	}
+	return GetConfigDB().GetLocation(), nil
+}
+
 // ChartsHandler renders charts for UI selections
 func ChartsHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
 	/* APIs
 	 * /bond/charts/:attr
 	 */
-	config := GetConfigDB()
+	config, err := GetRequestConfigDB(r)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": 0, "error": err.Error()})
+		return
+	}
 	attr := params.ByName("attr")
-	templ, err := GetChartTemplate(attr)
+	templ, err := GetChartTemplate()
 	if err != nil {
 		json.NewEncoder(w).Encode(map[string]interface{}{"ok": 0, "error": err})
 		return
 	}
 	title := charts[attr].Title
-	doc := map[string]interface{}{"Chart": charts[attr], "Config": config, "Title": title}
+	doc := map[string]interface{}{"Attr": attr, "Chart": charts[attr], "Config": config, "Options": GetChartOptions(r), "Title": title}
 	if err = templ.Execute(w, doc); err != nil {
 		json.NewEncoder(w).Encode(map[string]interface{}{"ok": 0, "error": err.Error()})
 		return
 	}
 }
 
+// ChartDataHandler responds to chart data API calls
+func ChartDataHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	/* APIs
+	 * /api/bond/v1.0/charts/:attr?from=2023-11-01T02:00&to=2023-11-02&granularity=day&tz=America/New_York
+	 * granularity is one of auto, minute, 5minutes, hour, day, and week
+	 * ns filters chunk_ownership and splits to a collection
+	 * since and until scope logs analysis as in other pages, from and to further filter the series
+	 */
+	w.Header().Set("Content-Type", "application/json")
+	config, err := GetRequestConfigDB(r)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": 0, "error": err.Error()})
+		return
+	}
+	loc, err := GetRequestLocation(r)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": 0, "error": err.Error()})
+		return
+	}
+	values := r.URL.Query()
+	from, err := ParseTime(values.Get("from"), loc)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": 0, "error": err.Error()})
+		return
+	}
+	to, err := ParseTime(values.Get("to"), loc)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": 0, "error": err.Error()})
+		return
+	}
+	data, err := config.GetChartData(params.ByName("attr"), from, to, values.Get("granularity"), loc, values.Get("ns"))
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": 0, "error": err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(data)
+}
+
 // DataHandler responds to API calls
 func DataHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
 	/* APIs
 	 * /api/bond/v1.0/data/:attr
+	 * /api/bond/v1.0/data/jumbo?jumbo.shard=shard&jumbo.page=1
+	 * /api/bond/v1.0/data/merge?ns=db.coll&batch=0
 	 */
 	attr := params.ByName("attr")
-	config := GetConfigDB()
+	config, err := GetRequestConfigDB(r)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": 0, "error": err.Error()})
+		return
+	}
 	if attr == "info" {
 		json.NewEncoder(w).Encode(config)
+	} else if attr == "movePrimary" {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(GetMovePrimaryScript(config.MovePrimaryPlan)))
+	} else if attr == "jumbo" {
+		chunks, _, err := config.GetJumboChunks()
+		if err != nil {
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": 0, "error": err.Error()})
+			return
+		}
+		chunks, jumboTable := GetJumboChunksPage(r, chunks)
+		for i := range chunks {
+			config.GetJumboChunkRemedy(&chunks[i])
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(config.GetJumboScript(chunks, jumboTable.Total)))
+	} else if attr == "merge" {
+		batch, _ := strconv.Atoi(r.URL.Query().Get("batch"))
+		plan, err := config.GetMergePlan(r.URL.Query().Get("ns"), true, batch)
+		if err != nil {
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": 0, "error": err.Error()})
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(config.GetMergeScript(plan)))
 	} else {
 		json.NewEncoder(w).Encode(map[string]interface{}{"ok": 0, "error": "unsupported attribute " + attr})
 	}
@@ -81,7 +234,11 @@ func InfoHandler(w http.ResponseWriter, r *http.Request, params httprouter.Param
 	/* APIs
 	 * /bond/info
 	 */
-	config := GetConfigDB()
+	config, err := GetRequestConfigDB(r)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": 0, "error": err.Error()})
+		return
+	}
 	templ, err := GetInfoTemplate()
 	if err != nil {
 		json.NewEncoder(w).Encode(map[string]interface{}{"ok": 0, "error": err})
@@ -92,11 +249,31 @@ func InfoHandler(w http.ResponseWriter, r *http.Request, params httprouter.Param
 	for _, v := range config.CollectionsMap {
 		colls = append(colls, v)
 	}
-	sort.Slice(colls, func(i, j int) bool {
-		return colls[i].Chunks > colls[j].Chunks
-	})
-	doc := map[string]interface{}{"Actionlog": config.Actions.Stats, "Collections": colls,
-		"Changelog": config.Changes.Stats, "Config": config, "TOP_N": TOP_N}
+	shards, shardsTable := GetShardsPage(r, config.ShardsMap)
+	mongos, mongosTable := GetMongosPage(r, config.Mongos)
+	databases, databasesTable := GetDatabasesPage(r, config.Databases)
+	colls, collsTable := GetCollectionsPage(r, "colls", colls)
+	namespaces, namespacesTable := GetMigrationTalliesPage(r, "migrationNamespaces", config.Changes.MigrationStats.Namespaces)
+	pairs, pairsTable := GetMigrationTalliesPage(r, "migrationPairs", config.Changes.MigrationStats.ShardPairs)
+	moveErrors, moveErrorsTable := GetChunkMoveErrorsPage(r, config.Changes.ChunkMoveErrors)
+	categories, categoriesTable := GetErrorCategoriesPage(r, "moveErrorCategories", config.Changes.ChunkMoveErrorCategories)
+	anomalies, anomaliesTable := GetBalancerAnomaliesPage(r, config.BalancerAnomalies)
+	roundErrors, roundErrorsTable := GetErrorCategoriesPage(r, "roundErrors", config.Actions.RoundErrorClusters)
+	splitRates, splitRatesTable := GetSplitRatesPage(r, config.SplitRates)
+	drainColls, drainCollsTable := GetDrainCollectionsPage(r, config.Drains)
+	drains, drainsTable := GetDrainsPage(r, config.Drains)
+	primaries, primariesTable := GetPrimaryShardsPage(r, config.PrimaryShards)
+	movePrimary, movePrimaryTable := GetMovePrimaryPlanPage(r, config.MovePrimaryPlan)
+	doc := map[string]interface{}{"Actionlog": config.Actions.Stats, "BalancerAnomalies": anomalies, "BalancerAnomaliesTable": anomaliesTable,
+		"Changelog": config.Changes.Stats, "Config": config,
+		"ChunkMoveErrorCategories": categories, "ChunkMoveErrorCategoriesTable": categoriesTable,
+		"ChunkMoveErrors": moveErrors, "ChunkMoveErrorsTable": moveErrorsTable, "Collections": colls, "CollectionsTable": collsTable, "Databases": databases, "DatabasesTable": databasesTable,
+		"DrainCollections": drainColls, "DrainCollectionsTable": drainCollsTable, "Drains": drains, "DrainsTable": drainsTable,
+		"MigrationNamespaces": namespaces, "MigrationNamespacesTable": namespacesTable,
+		"MigrationShardPairs": pairs, "MigrationShardPairsTable": pairsTable,
+		"Mongos": mongos, "MongosTable": mongosTable, "MovePrimaryPlan": movePrimary, "MovePrimaryTable": movePrimaryTable,
+		"PrimaryShards": primaries, "PrimaryShardsTable": primariesTable, "RoundErrorClusters": roundErrors, "RoundErrorClustersTable": roundErrorsTable,
+		"Shards": shards, "ShardsTable": shardsTable, "SplitRates": splitRates, "SplitRatesTable": splitRatesTable}
 	if err = templ.Execute(w, doc); err != nil {
 		json.NewEncoder(w).Encode(map[string]interface{}{"ok": 0, "error": err.Error()})
 		return
@@ -138,7 +315,7 @@ func ShardChartHandler(w http.ResponseWriter, r *http.Request, params httprouter
 		docs = append(docs, nv)
 	}
 	title := fmt.Sprintf("Collection Chunk Distribution within a Shard\n%s", shard)
-	doc := map[string]interface{}{"NameValues": docs, "Title": title}
+	doc := map[string]interface{}{"NameValues": docs, "Options": GetChartOptions(r), "Title": title}
 	if err = templ.Execute(w, doc); err != nil {
 		json.NewEncoder(w).Encode(map[string]interface{}{"ok": 0, "error": err.Error()})
 		return
@@ -179,8 +356,208 @@ func NamespaceChartHandler(w http.ResponseWriter, r *http.Request, params httpro
 		nv := NameValue{"'Beyond the top 10'", others}
 		docs = append(docs, nv)
 	}
-	title := fmt.Sprintf("Collection Chunk Distribution among Shards\n%s", ns)
-	doc := map[string]interface{}{"NameValues": docs, "Title": title}
+	title := fmt.Sprintf("Collection Chunk Distribution among Shards\n%s", GetUserNamespace(ns))
+	doc := map[string]interface{}{"NameValues": docs, "Options": GetChartOptions(r), "Title": title}
+	if err = templ.Execute(w, doc); err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": 0, "error": err.Error()})
+		return
+	}
+}
+
+// DatabaseHandler renders sharded and unsharded collections of a database
+func DatabaseHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	/* APIs
+	 * /bond/databases/:db
+	 */
+	config := GetConfigDB()
+	templ, err := GetDatabaseTemplate()
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": 0, "error": err})
+		return
+	}
+	info, err := config.GetDatabaseInfo(params.ByName("db"))
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": 0, "error": err.Error()})
+		return
+	}
+	colls, collsTable := GetCollectionsPage(r, "colls", info.Collections)
+	unsharded, unshardedTable := GetUnshardedPage(r, info.Unsharded)
+	doc := map[string]interface{}{"Collections": colls, "CollectionsTable": collsTable, "Config": config,
+		"Database": info, "Unsharded": unsharded, "UnshardedTable": unshardedTable}
+	if err = templ.Execute(w, doc); err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": 0, "error": err.Error()})
+		return
+	}
+}
+
+// JumboHandler renders jumbo chunks, sizes and remedies are of chunks of the page
+func JumboHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	/* APIs
+	 * /bond/jumbo?jumbo.q=db.coll
+	 * /bond/jumbo?jumbo.shard=shard
+	 * /bond/jumbo?refresh=1
+	 */
+	config := GetConfigDB()
+	templ, err := GetJumboTemplate()
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": 0, "error": err})
+		return
+	}
+	if query := r.URL.Query(); query.Get("refresh") == "1" { // sizes once, not again by sorting or paging
+		config.ClearJumboRemedies()
+		query.Del("refresh")
+		http.Redirect(w, r, r.URL.Path+"?"+query.Encode(), http.StatusSeeOther)
+		return
+	}
+	chunks, truncated, err := config.GetJumboChunks()
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": 0, "error": err.Error()})
+		return
+	}
+	chunks, jumboTable := GetJumboChunksPage(r, chunks)
+	for i := range chunks {
+		config.GetJumboChunkRemedy(&chunks[i])
+	}
+	doc := map[string]interface{}{"Config": config, "Jumbo": chunks, "JumboTable": jumboTable, "MaxJumbo": MAX_JUMBO_CHUNKS,
+		"Shard": r.URL.Query().Get("jumbo.shard"), "Truncated": truncated}
+	if err = templ.Execute(w, doc); err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": 0, "error": err.Error()})
+		return
+	}
+}
+
+// MergesHandler renders collections having the most chunks, or suggested chunk merges of a collection
+func MergesHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	/* APIs
+	 * /bond/merges
+	 * /bond/merges?ns=db.coll&batch=0
+	 * /bond/merges?ns=db.coll&refresh=1
+	 */
+	config := GetConfigDB()
+	templ, err := GetMergesTemplate()
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": 0, "error": err})
+		return
+	}
+	doc := map[string]interface{}{"Config": config}
+	if ns := r.URL.Query().Get("ns"); ns != "" {
+		if query := r.URL.Query(); query.Get("refresh") == "1" { // sizes once, not again by sorting or paging
+			config.ClearMergePlans(ns)
+			query.Del("refresh")
+			http.Redirect(w, r, r.URL.Path+"?"+query.Encode(), http.StatusSeeOther)
+			return
+		}
+		batch, _ := strconv.Atoi(r.URL.Query().Get("batch"))
+		plan, err := config.GetMergePlan(ns, true, batch)
+		if err != nil {
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": 0, "error": err.Error()})
+			return
+		}
+		merges, mergesTable := GetChunkMergesPage(r, plan.Merges)
+		doc["Plan"], doc["Merges"], doc["MergesTable"] = plan, merges, mergesTable
+	} else {
+		plans, err := config.GetMergeCandidates()
+		if err != nil {
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": 0, "error": err.Error()})
+			return
+		}
+		doc["Plans"] = plans
+	}
+	if err = templ.Execute(w, doc); err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": 0, "error": err.Error()})
+		return
+	}
+}
+
+// CollectionHandler renders a sharded collection
+func CollectionHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	/* APIs
+	 * /bond/collections/:ns
+	 * /bond/collections/:ns?analyze=1&key={"region":1,"_id":1}
+	 * /bond/collections/:ns?analyze=1&key={"region":1,"_id":1}&refresh=1
+	 */
+	config := GetConfigDB()
+	templ, err := GetCollectionTemplate()
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": 0, "error": err})
+		return
+	}
+	ns := params.ByName("ns")
+	if query := r.URL.Query(); query.Get("refresh") == "1" { // analyzes once, not again by reloading
+		config.ClearShardKeyAnalyses(ns)
+		query.Del("refresh")
+		http.Redirect(w, r, r.URL.Path+"?"+query.Encode(), http.StatusSeeOther)
+		return
+	}
+	info, err := config.GetCollectionInfo(ns)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": 0, "error": err.Error()})
+		return
+	}
+	query := r.URL.Query()
+	doc := map[string]interface{}{"CanAnalyze": config.CanAnalyzeShardKey(), "CandidateKey": query.Get("key"),
+		"Collection": info, "Config": config}
+	if analyzer, ok := config.QueryAnalyzers[info.GetName()]; ok {
+		doc["QueryAnalyzer"] = &analyzer
+	} else if analyzer, ok = config.QueryAnalyzers[info.ID]; ok {
+		doc["QueryAnalyzer"] = &analyzer
+	}
+	if query.Get("analyze") == "1" && config.CanAnalyzeShardKey() { // samples documents, only if requested and not cached
+		doc["Analysis"], doc["Candidate"] = config.CompareShardKeys(ns, query.Get("key"))
+	}
+	if err = templ.Execute(w, doc); err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": 0, "error": err.Error()})
+		return
+	}
+}
+
+// EventsHandler renders DDL and topology events
+func EventsHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	/* APIs
+	 * /bond/events?events.type=shardCollection&events.q=db.coll
+	 */
+	config, err := GetRequestConfigDB(r)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": 0, "error": err.Error()})
+		return
+	}
+	templ, err := GetEventsTemplate()
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": 0, "error": err})
+		return
+	}
+	events, eventsTable := GetChangeEventsPage(r, config.Changes.ChangeEvents)
+	doc := map[string]interface{}{"Config": config, "EventType": r.URL.Query().Get("events.type"),
+		"EventTypes": ChangeEventTypes, "Events": events, "EventsTable": eventsTable}
+	if err = templ.Execute(w, doc); err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": 0, "error": err.Error()})
+		return
+	}
+}
+
+// SimulateHandler renders balancer simulations after adding shards or draining a shard
+func SimulateHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	/* APIs
+	 * /bond/simulate?add=2&drain=shard01
+	 */
+	config, err := GetRequestConfigDB(r)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": 0, "error": err.Error()})
+		return
+	}
+	templ, err := GetSimulateTemplate()
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": 0, "error": err})
+		return
+	}
+	values := r.URL.Query()
+	add, drain := ToInt(values.Get("add")), values.Get("drain")
+	doc := map[string]interface{}{"Add": add, "Config": config, "Drain": drain}
+	if simulation, err := config.Simulate(add, drain); err != nil {
+		doc["Error"] = err.Error()
+	} else {
+		doc["Simulation"] = simulation
+	}
 	if err = templ.Execute(w, doc); err != nil {
 		json.NewEncoder(w).Encode(map[string]interface{}{"ok": 0, "error": err.Error()})
 		return
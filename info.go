@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"html/template"
 	"math/rand"
+	"net/url"
 	"strings"
 	"time"
 
@@ -27,9 +28,14 @@ func GetInfoTemplate() (*template.Template, error) {
 		<tr><td style='border:none; vertical-align: top; padding: 5px; background-color: var(--background-color);'>
 			<img class='rotate23' src='data:image/png;base64,{{ assignConsultant $flag }}'></img></td>
 			<td class='summary'>{{consultantIntro $flag}} ` + SummaryHTML + "</td></tr></table></div>"
-	html += InfoHTML + LogsHTML + BondVideoHTML + MongosHTML + ChunkMoveErrorsHTML + ShardsHTML + DatabasesHTML + CollectionsHTML
+	html += InfoHTML + LogsHTML + BondVideoHTML + MongosHTML + BalancerAnomaliesHTML + RoundErrorsHTML + ChunkMoveErrorsHTML + MigrationsHTML + SplitRatesHTML + ShardsHTML + DrainsHTML + PrimaryShardsHTML + MovePrimaryHTML + DatabasesHTML + CollectionsHTML
 	html += "</body></html>"
-	return template.New("bond").Funcs(template.FuncMap{
+	return template.New("bond").Funcs(infoFuncMap()).Parse(html)
+}
+
+// infoFuncMap returns template functions shared by info pages
+func infoFuncMap() template.FuncMap {
+	return template.FuncMap{
 		"add": func(a int, b int) int {
 			return a + b
 		},
@@ -63,13 +69,6 @@ func GetInfoTemplate() (*template.Template, error) {
 			}
 			return template.HTML("<i class='fa fa-check'></i>")
 		},
-		"getCountLabel": func(n int, prefix string) string {
-			printer := message.NewPrinter(language.English)
-			if n > TOP_N {
-				return printer.Sprintf("%s %d of %d", prefix, TOP_N, n)
-			}
-			return printer.Sprintf("%d", n)
-		},
 		"getDurationFromSeconds": func(s int64) string {
 			return gox.GetDurationFromSeconds(float64(s))
 		},
@@ -91,6 +90,7 @@ func GetInfoTemplate() (*template.Template, error) {
 		"getStorageSize": func(size int64) string {
 			return gox.GetStorageSize(float64(size))
 		},
+		"getUserNamespace": GetUserNamespace,
 		"getUserSymbol": func(b bool) template.HTML {
 			if !b {
 				return template.HTML("")
@@ -116,10 +116,19 @@ func GetInfoTemplate() (*template.Template, error) {
 			layout := "2006-01-02T15:04:05Z"
 			return t.Time().Format(layout)
 		},
+		"ISOTime": func(t *time.Time) string {
+			if t == nil {
+				return ""
+			}
+			return t.UTC().Format("2006-01-02T15:04:05Z")
+		},
 		"numPrinter": func(n interface{}) string {
 			printer := message.NewPrinter(language.English)
 			return printer.Sprintf("%v", ToInt(n))
 		},
+		"pathURL": func(path string, name interface{}) template.URL { // a page of a name, e.g. /bond/collections/db.coll
+			return template.URL(path + url.PathEscape(toString(name)))
+		},
 		"plural": func(num int, word string, tail string) string {
 			if num == 0 {
 				return "no " + word
@@ -129,9 +138,28 @@ func GetInfoTemplate() (*template.Template, error) {
 			printer := message.NewPrinter(language.English)
 			return printer.Sprintf("%d %s%s", num, word, tail)
 		},
+		"queryURL": func(path string, key string, value interface{}) template.URL {
+			return template.URL(path + "?" + url.QueryEscape(key) + "=" + url.QueryEscape(toString(value)))
+		},
+		"sortHeader": getSortHeader,
 		"stringify": func(doc interface{}) string {
 			return Stringify(doc)
-		}}).Parse(html)
+		},
+		"tablePager": getTablePager}
+}
+
+// toString returns a string or the value of a string pointer, e.g. _id of a shard
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case *string:
+		if v != nil {
+			return *v
+		}
+		return ""
+	}
+	return fmt.Sprintf("%v", value)
 }
 
 const (
@@ -153,6 +181,9 @@ const (
 	Be sure to
 	{{end}}
 	review the provided statistics and don't forget to check out the charts to better understand the performance of your cluster.
+	{{if or .Config.Since .Config.Until}}
+	<p/>Action and change logs statistics, charts, and findings are scoped to the time window{{if .Config.Since}} since {{ISOTime .Config.Since}}{{end}}{{if .Config.Until}} until {{ISOTime .Config.Until}}{{end}}.
+	{{end}}
 	`
 
 	// general info
@@ -168,6 +199,13 @@ const (
 
 			<tr><td align='left' class='rowtitle'>Number of Databases</td><td align='right' class='break'>{{ numPrinter (len .Config.Databases) }}</td></tr>
 			<tr><td align='left' class='rowtitle'>Number of Sharded Collections</td><td align='right' class='break'>{{ numPrinter (len .Config.CollectionsMap) }}</td></tr>
+			<tr><td align='left' class='rowtitle'>Cluster Balance Score</td><td align='right' class='break'>{{ printf "%.1f%%" .Config.BalanceScore }}</td></tr>
+			<tr><td align='left' class='rowtitle'>Is Balancer Enabled?</td><td align='center' class='break'>{{ getCheckMarkSymbol .Config.Balancer.IsEnabled }}{{ getWarningSymbol .Config.Balancer.IsEnabled }}</td></tr>
+		{{if .Config.Balancer.ActiveWindow}}
+			<tr><td align='left' class='rowtitle'>Balancer Active Window</td><td align='center' class='break'>{{ .Config.Balancer.ActiveWindow.Start }} to {{ .Config.Balancer.ActiveWindow.Stop }} {{ .Config.GetWindowLocation }}</td></tr>
+		{{end}}
+			<tr><td align='left' class='rowtitle'>Last Balancer Round</td><td align='center' class='break'>{{ ISOTime .Config.Activity.LastRound }} {{getWarningSymbol (not .Config.Activity.IsStale) }}</td></tr>
+			<tr><td align='left' class='rowtitle'>Last Migration</td><td align='center' class='break'>{{ ISOTime .Config.Activity.LastMigration }} {{getWarningSymbol (not .Config.Activity.IsIdle) }}</td></tr>
 
 		{{if ne .Actionlog.Capped nil}}
 			<tr><td align='left' class='rowtitle'>Number of Balancer Rounds</td><td align='right' class='break'>{{ numPrinter .Actionlog.TotalChunksMoved }}</td></tr>
@@ -185,6 +223,10 @@ const (
 	// logs
 	LogsHTML = `<div style='float: left;'>
 		<table width=400px><caption>Action and Change Logs</caption><tr><th>Metric</th><th>Value</th>
+			<tr><td align='left' class='rowtitle'>Since</td><td align='center' class='break'>
+				<input type='text' placeholder='yyyy-mm-ddThh:mm' size='16' value='{{ISOTime .Config.Since}}' onchange="setQueryParam('since', this.value)"/></td></tr>
+			<tr><td align='left' class='rowtitle'>Until</td><td align='center' class='break'>
+				<input type='text' placeholder='yyyy-mm-ddThh:mm' size='16' value='{{ISOTime .Config.Until}}' onchange="setQueryParam('until', this.value)"/></td></tr>
 		{{if ne .Actionlog.Capped nil}}
 			<tr><td align='left' class='rowtitle'>Is config.actionlog capped?</td><td align='center' class='break'>{{getCheckMarkSymbol .Actionlog.Capped}}{{getWarningSymbol .Actionlog.Capped}}</td></tr>
 			<tr><td align='left' class='rowtitle'>Size of config.actionlog</td><td align='right' class='break'>{{getStorageSize .Actionlog.MaxSize}}</td></tr>
@@ -196,64 +238,240 @@ const (
 		{{end}}
 		</table></div>`
 
+	// balancer anomalies
+	BalancerAnomaliesHTML = `
+{{if gt (len .Config.BalancerAnomalies) 0}}
+	<div style='float: left;'>
+	{{$q:=.BalancerAnomaliesTable}}
+	<table><caption>Balancer Anomalies ({{numPrinter $q.Total}})</caption><tr><th>#</th>
+	{{sortHeader $q "kind" "Anomaly"}}{{sortHeader $q "start" "Start"}}{{sortHeader $q "end" "End"}}{{sortHeader $q "rounds" "Rounds"}}<th>Detail</th>
+	{{range $n, $value := .BalancerAnomalies}}
+			<tr>
+				<td align='right' class='break'>{{ add $q.Start (add $n 1) }}</td>
+				<td align='left' class='break'>{{ $value.Kind }}</td>
+				<td align='left' class='break'>{{ ISODate $value.Start }}</td>
+				<td align='left' class='break'>{{ ISODate $value.End }}</td>
+				<td align='right' class='break'>{{ numPrinter $value.Rounds }}</td>
+				<td align='left' class='break'>{{ $value.Detail }}</td>
+			</tr>
+	{{end}}
+	</table>
+	{{tablePager $q}}</div>
+{{end}}`
+
+	// balancer round errors
+	RoundErrorsHTML = `
+{{if gt .Actionlog.TotalErrors 0}}
+	<div style='float: left;'>
+	{{$q:=.RoundErrorClustersTable}}
+	<table><caption>Balancer Round Errors ({{numPrinter $q.Total}})</caption><tr><th>#</th>
+	{{sortHeader $q "category" "Category"}}{{sortHeader $q "total" "Total"}}{{sortHeader $q "first" "First"}}{{sortHeader $q "last" "Last"}}<th>Message Pattern</th>
+	{{range $n, $value := .RoundErrorClusters}}
+			<tr>
+				<td align='right' class='break'>{{ add $q.Start (add $n 1) }}</td>
+				<td align='left' class='break'>{{ $value.Category }}</td>
+				<td align='right' class='break'>{{ numPrinter $value.Total }}</td>
+				<td align='left' class='break'>{{ ISODate $value.First }}</td>
+				<td align='left' class='break'>{{ ISODate $value.Last }}</td>
+				<td align='left' class='break'>{{ $value.Example }}</td>
+			</tr>
+	{{end}}
+	</table>
+	{{tablePager $q}}</div>
+{{end}}`
+
 	// chunkMove errors
 	ChunkMoveErrorsHTML = `
-	{{if gt .Changelog.TotalChunkMoveErrors 0}}
-		<div style='float: left;'>
-		<table><caption>Chunk Move Errors</caption><tr><th>#</th>
-		<th>Donor Shard</th><th>Recipient Shard</th><th>Total</th></th>
-		{{$cnt:=0}}
-		{{range $n, $value := .Config.Changes.ChunkMoveErrors}}
-			{{$cnt = add $cnt 1}}
-				<tr>
-					<td align='right' class='break'>{{ $cnt }}</td>
-					<td align='left' class='break'>{{$value.From}}</td>
-					<td align='left' class='break'>{{ $value.To }}</td>
-					<td align='right' class='break'>{{ numPrinter $value.Total }}</td>
-				</tr>
-		{{end}}
+{{if gt .Changelog.TotalChunkMoveErrors 0}}
+	<div style='float: left;'>
+	{{$q:=.ChunkMoveErrorCategoriesTable}}
+	<table><caption>Chunk Move Error Categories ({{numPrinter $q.Total}})</caption><tr><th>#</th>
+	{{sortHeader $q "category" "Category"}}{{sortHeader $q "total" "Total"}}{{sortHeader $q "namespaces" "Namespaces"}}{{sortHeader $q "first" "First"}}{{sortHeader $q "last" "Last"}}<th>Example</th>
+	{{range $n, $value := .ChunkMoveErrorCategories}}
+			<tr>
+				<td align='right' class='break'>{{ add $q.Start (add $n 1) }}</td>
+				<td align='left' class='break'>{{ $value.Category }}</td>
+				<td align='right' class='break'>{{ numPrinter $value.Total }}</td>
+				<td align='right' class='break'>{{ numPrinter (len $value.Namespaces) }}</td>
+				<td align='left' class='break'>{{ ISODate $value.First }}</td>
+				<td align='left' class='break'>{{ ISODate $value.Last }}</td>
+				<td align='left' class='break'>{{ $value.Example }}</td>
+			</tr>
 	{{end}}
-		</table></div>`
+	</table>
+	{{tablePager $q}}</div>
+
+	<div style='float: left;'>
+	{{$q:=.ChunkMoveErrorsTable}}
+	<table><caption>Chunk Move Errors ({{numPrinter $q.Total}})</caption><tr><th>#</th>
+	{{sortHeader $q "from" "Donor Shard"}}{{sortHeader $q "to" "Recipient Shard"}}{{sortHeader $q "ns" "Namespace"}}{{sortHeader $q "category" "Category"}}{{sortHeader $q "total" "Total"}}{{sortHeader $q "last" "Last"}}
+	{{range $n, $value := .ChunkMoveErrors}}
+			<tr>
+				<td align='right' class='break'>{{ add $q.Start (add $n 1) }}</td>
+				<td align='left' class='break'>{{ $value.From }}</td>
+				<td align='left' class='break'>{{ $value.To }}</td>
+				<td align='left' class='break'>{{ getUserNamespace $value.NS }}</td>
+				<td align='left' class='break'><span title='{{ $value.ErrMsg }}'>{{ $value.Category }}</span></td>
+				<td align='right' class='break'>{{ numPrinter $value.Total }}</td>
+				<td align='left' class='break'>{{ ISODate $value.Last }}</td>
+			</tr>
+	{{end}}
+	</table>
+	{{tablePager $q}}</div>
+{{end}}`
+
+	// chunk split rates
+	SplitRatesHTML = `
+{{if gt (len .Config.SplitRates) 0}}
+	<div style='float: left;'>
+	{{$q:=.SplitRatesTable}}
+	<table><caption>Chunk Split Rates ({{numPrinter $q.Total}})</caption><tr><th>#</th>
+	{{sortHeader $q "ns" "Namespace"}}{{sortHeader $q "total" "Splits"}}{{sortHeader $q "rate" "Splits/Hour"}}{{sortHeader $q "peak" "Peak in 10 Minutes"}}{{sortHeader $q "bursts" "Bursts"}}{{sortHeader $q "shards" "Shards"}}<th>-</th>
+	{{range $n, $value := .SplitRates}}
+			<tr>
+				<td align='right' class='break'>{{ add $q.Start (add $n 1) }}</td>
+				<td align='left' class='break'>{{ getUserNamespace $value.NS }}</td>
+				<td align='right' class='break'>{{ numPrinter $value.Total }}</td>
+				<td align='right' class='break'>{{ printf "%.1f" $value.Rate }}</td>
+				<td align='right' class='break'>{{ numPrinter $value.Peak }}</td>
+				<td align='right' class='break'>{{ $value.Bursts }} {{getWarningSymbol (eq $value.Bursts 0) }}</td>
+				<td align='left' class='break'>{{range $i, $shard := $value.Shards}}{{if $i}}, {{end}}{{$shard.Name}} ({{numPrinter $shard.Value}}){{end}}</td>
+				<td align='center'><a class='btn' href='{{queryURL "/bond/charts/splits" "ns" $value.NS}}'>
+					<i class='fa fa-bar-chart' style='font-size: .8em;'></i></a></td>
+			</tr>
+	{{end}}
+	</table>
+	{{tablePager $q}}</div>
+{{end}}`
 
 	// shards
 	ShardsHTML = `
 {{if gt (len .Config.ShardsMap) 0}}
 	<div style='float: left;'>
-	<table><caption>Shards</caption><tr><th>#</th>
-	<th>Shard Name</th><th>Host</th><th>State</th><th>Chunks</th><th>Jumbo</th><th>Max Size</th><th>-</th>
-	{{$cnt:=0}}
-	{{range $n, $value := .Config.ShardsMap}}
-		{{$cnt = add $cnt 1}}
+	{{$q:=.ShardsTable}}
+	<table><caption>Shards ({{numPrinter $q.Total}})</caption><tr><th>#</th>
+	{{sortHeader $q "_id" "Shard Name"}}{{sortHeader $q "host" "Host"}}{{sortHeader $q "state" "State"}}{{sortHeader $q "chunks" "Chunks"}}{{sortHeader $q "jumbo" "Jumbo"}}{{sortHeader $q "maxSize" "Max Size"}}<th>-</th>
+	{{range $n, $value := .Shards}}
 			<tr>
-				<td align='right' class='break'>{{ $cnt }}</td>
+				<td align='right' class='break'>{{ add $q.Start (add $n 1) }}</td>
 				<td align='left' class='break'>{{$value.ID}}</td>
 				<td align='left' class='break'>{{ $value.Host }}</td>
+			{{if $value.IsDraining}}
+				<td align='right' class='break'>{{ $value.State }} draining</td>
+			{{else}}
 				<td align='right' class='break'>{{ $value.State }}</td>
+			{{end}}
 				<td align='right' class='break'>{{ numPrinter $value.Chunks }}</td>
+			{{if gt $value.Jumbo 0}}
+				<td align='right' class='break'><a href='{{queryURL "/bond/jumbo" "jumbo.shard" $value.ID}}'>{{ numPrinter $value.Jumbo }}</a> {{getWarningSymbol false}}</td>
+			{{else}}
 				<td align='right' class='break'>{{ numPrinter $value.Jumbo }}</td>
+			{{end}}
 			{{if not $value.MaxSize}}
 				<td align='right' class='break'></td>
 			{{else}}
 				<td align='right' class='break'>{{ $value.MaxSize }} {{getWarningSymbol false}}</td>
 			{{end}}
-				<td align='center'><button class='btn'
-					onClick="javascript:loadData('/bond/chart/shards/{{$value.ID}}'); return false;">
-					<i class='fa fa-pie-chart' style='font-size: .8em;'></i></button></td>
+				<td align='center'><a class='btn' href='{{pathURL "/bond/chart/shards/" $value.ID}}'>
+					<i class='fa fa-pie-chart' style='font-size: .8em;'></i></a></td>
 			</tr>
 	{{end}}
-{{end}}
-	</table></div>`
+	</table>
+	{{tablePager $q}}</div>
+{{end}}`
+
+	// draining shards
+	DrainsHTML = `
+{{if gt (len .Config.Drains) 0}}
+	<div style='float: left;'>
+	{{$q:=.DrainsTable}}
+	<table><caption>Draining Shards ({{numPrinter $q.Total}})</caption><tr><th>#</th>
+	{{sortHeader $q "shard" "Shard Name"}}{{sortHeader $q "chunks" "Remaining Chunks"}}{{sortHeader $q "jumbo" "Jumbo"}}{{sortHeader $q "collections" "Collections"}}{{sortHeader $q "databases" "Databases to movePrimary"}}
+	{{sortHeader $q "rate" "Chunks/Hour"}}{{sortHeader $q "eta" "ETA"}}{{sortHeader $q "lastMigration" "Last Migration"}}
+	{{range $n, $value := .Drains}}
+			<tr>
+				<td align='right' class='break'>{{ add $q.Start (add $n 1) }}</td>
+				<td align='left' class='break'>{{ $value.Shard }}</td>
+				<td align='right' class='break'>{{ numPrinter $value.Chunks }} {{getWarningSymbol (not $value.IsStuck) }}</td>
+				<td align='right' class='break'>{{ numPrinter $value.Jumbo }}</td>
+				<td align='right' class='break'>{{ numPrinter (len $value.Collections) }}</td>
+				<td align='left' class='break'>{{range $i, $db := $value.Databases}}{{if $i}}, {{end}}{{$db}}{{end}}</td>
+				<td align='right' class='break'>{{ printf "%.1f" $value.Rate }}</td>
+				<td align='right' class='break'>{{if $value.GetETA}}{{ $value.GetETA }}{{else}}unknown{{end}}</td>
+				<td align='left' class='break'>{{ ISOTime $value.LastMigration }}</td>
+			</tr>
+	{{end}}
+	</table>
+	{{tablePager $q}}</div>
+
+	<div style='float: left;'>
+	{{$q:=.DrainCollectionsTable}}
+	<table><caption>Remaining Chunks on Draining Shards ({{numPrinter $q.Total}})</caption><tr><th>#</th>
+	{{sortHeader $q "ns" "Namespace"}}{{sortHeader $q "shard" "Shard Name"}}{{sortHeader $q "chunks" "Chunks"}}{{sortHeader $q "noBalance" "noBalance"}}
+	{{range $n, $value := .DrainCollections}}
+			<tr>
+				<td align='right' class='break'>{{ add $q.Start (add $n 1) }}</td>
+				<td align='left' class='break'>{{ getUserNamespace $value.NS }}</td>
+				<td align='left' class='break'>{{ $value.Shard }}</td>
+				<td align='right' class='break'>{{ numPrinter $value.Chunks }}</td>
+				<td align='center' class='break'>{{if $value.NoBalance}}{{getWarningSymbol false}}{{end}}</td>
+			</tr>
+	{{end}}
+	</table>
+	{{tablePager $q}}</div>
+{{end}}`
+
+	// primary shards
+	PrimaryShardsHTML = `
+{{if gt (len .Config.PrimaryShards) 0}}
+	<div style='float: left;'>
+	{{$q:=.PrimaryShardsTable}}
+	<table><caption>Primary Shards ({{numPrinter $q.Total}})</caption><tr><th>#</th>
+	{{sortHeader $q "shard" "Shard Name"}}{{sortHeader $q "databases" "Databases"}}{{sortHeader $q "unshardedSize" "Unsharded Data Size"}}
+	{{range $n, $value := .PrimaryShards}}
+			<tr>
+				<td align='right' class='break'>{{ add $q.Start (add $n 1) }}</td>
+				<td align='left' class='break'>{{ $value.Shard }}</td>
+				<td align='right' class='break'>{{ numPrinter (len $value.Databases) }} {{getWarningSymbol (not $value.IsOverloaded) }}</td>
+				<td align='right' class='break'>{{ getStorageSize $value.UnshardedSize }}{{if $value.Unsized}} and {{ numPrinter (len $value.Unsized) }} databases of unknown size{{end}}</td>
+			</tr>
+	{{end}}
+	</table>
+	{{tablePager $q}}</div>
+{{end}}`
+
+	// suggested movePrimary plan
+	MovePrimaryHTML = `
+{{if gt (len .Config.MovePrimaryPlan) 0}}
+	<div style='float: left;'>
+	{{$q:=.MovePrimaryTable}}
+	<table><caption>Suggested movePrimary Plan ({{numPrinter $q.Total}}) <a href='/api/bond/v1.0/data/movePrimary' target='_blank'
+		title='review the script, it is never executed by Bond'><i class='fa fa-file-code-o'></i></a></caption><tr><th>#</th>
+	{{sortHeader $q "database" "Database Name"}}{{sortHeader $q "from" "From"}}{{sortHeader $q "to" "To"}}{{sortHeader $q "size" "Unsharded Data Size"}}
+	{{range $n, $value := .MovePrimaryPlan}}
+			<tr>
+				<td align='right' class='break'>{{ add $q.Start (add $n 1) }}</td>
+				<td align='left' class='break'>{{ $value.Database }}</td>
+				<td align='left' class='break'>{{ $value.From }}</td>
+				<td align='left' class='break'>{{ $value.To }}</td>
+				<td align='right' class='break'>{{ getStorageSize $value.Size }}</td>
+			</tr>
+	{{end}}
+	</table>
+	{{tablePager $q}}</div>
+{{end}}`
 
 	// mongos
 	MongosHTML = `
 	{{if gt (len .Config.Mongos) 0}}
 		<div style='float: left;'>
-			<table><caption>mongos Instances</caption><tr><th>#</th>
-				<th>_id</th><th>Version</th><th>Ping</th><th>Up</th><th>Waiting</th><th>Created</th>
+		{{$q:=.MongosTable}}
+			<table><caption>mongos Instances ({{numPrinter $q.Total}})</caption><tr><th>#</th>
+				{{sortHeader $q "_id" "_id"}}{{sortHeader $q "mongoVersion" "Version"}}{{sortHeader $q "ping" "Ping"}}{{sortHeader $q "up" "Up"}}{{sortHeader $q "waiting" "Waiting"}}{{sortHeader $q "created" "Created"}}
 		{{$majorVersion := .Config.MajorVersion}}
-		{{range $n, $value := .Config.Mongos}}
+		{{range $n, $value := .Mongos}}
 				<tr>
-					<td align='right' class='break'>{{ add $n 1 }}</td>
+					<td align='right' class='break'>{{ add $q.Start (add $n 1) }}</td>
 					<td align='left' class='break'>{{ $value.ID }}</td>
 				{{ if (checkVersion $value.MongoVersion $majorVersion) }}
 					<td align='center' class='break'>{{$value.MongoVersion}}</td>
@@ -270,53 +488,56 @@ const (
 					<td align='left' class='break'>{{ ISODate $value.Created }}</td>
 				</tr>
 		{{end}}
-	{{end}}
-		</table></div>`
+			</table>
+		{{tablePager $q}}</div>
+	{{end}}`
 
 	// Databases
 	DatabasesHTML = `
 {{if gt (len .Config.Databases) 0}}
 	<div style='float: left;'>
-	<table><caption>{{getCountLabel (len .Config.Databases) "First"}} Databases</caption><tr><th>#</th>
-	<th>Database Name</th><th>Primary</th><th>Partitioned</th>
-	{{$limit:=.TOP_N}}
-	{{range $n, $value := .Config.Databases}}
-		{{if lt $n $limit}}
+	{{$q:=.DatabasesTable}}
+	<table><caption>Databases ({{numPrinter $q.Total}})</caption><tr><th>#</th>
+	{{sortHeader $q "_id" "Database Name"}}{{sortHeader $q "primary" "Primary"}}{{sortHeader $q "partitioned" "Partitioned"}}
+	{{range $n, $value := .Databases}}
 			<tr>
-				<td align='right' class='break'>{{ add $n 1 }}</td>
-				<td align='left' class='break'>{{ $value.ID }}</td>
+				<td align='right' class='break'>{{ add $q.Start (add $n 1) }}</td>
+				<td align='left' class='break'><a href='{{pathURL "/bond/databases/" $value.ID}}{{$.Config.GetWindowQuery}}'>{{ $value.ID }}</a></td>
 				<td align='left' class='break'>{{ $value.Primary }}</td>
 				<td align='center' class='break'>{{ getCheckMarkSymbol $value.Partitioned }}</td>
 			</tr>
-		{{end}}
 	{{end}}
-{{end}}
-	</table></div>`
+	</table>
+	{{tablePager $q}}</div>
+{{end}}`
 
 	// Collections
 	CollectionsHTML = `
-{{if gt (len .Collections) 0}}
+{{if gt (len .Config.CollectionsMap) 0}}
 	<div style='float: left;'>
-	<table><caption>{{getCountLabel (len .Collections) "Top"}} Sharded Collections</caption><tr><th>#</th>
-	<th>Collection Name</th><th>Shard Key</th><th>Unique</th><th>No Balance</th><th>Chunks</th><th>-</th>
-	{{$limit:=.TOP_N}}
+	{{$q:=.CollectionsTable}}
+	<table><caption>Sharded Collections ({{numPrinter $q.Total}})</caption><tr><th>#</th>
+	{{sortHeader $q "_id" "Collection Name"}}{{sortHeader $q "key" "Shard Key"}}{{sortHeader $q "unique" "Unique"}}{{sortHeader $q "noBalance" "No Balance"}}{{sortHeader $q "chunks" "Chunks"}}{{sortHeader $q "balance" "Balance"}}{{sortHeader $q "compliant" "Compliant"}}<th>-</th>
 	{{range $n, $value := .Collections}}
-		{{if lt $n $limit}}
 			<tr>
-				<td align='right' class='break'>{{ add $n 1 }}</td>
-				<td align='left' class='break'>{{$value.ID}}</td>
-				<td align='left' class='break'>{{ stringify $value.Key }}</td>
+				<td align='right' class='break'>{{ add $q.Start (add $n 1) }}</td>
+				<td align='left' class='break'><a href='{{pathURL "/bond/collections/" $value.ID}}'>{{ $value.GetName }}</a>{{if $value.IsTimeseries}} <i class='fa fa-clock-o' title='time-series buckets {{$value.ID}}'></i>{{end}}{{if $value.IsMigrationsDisabled}} <i class='fa fa-ban' style='color:red;' title='migrations disabled'></i>{{end}}{{if $value.HasCustomChunkSize $.Config.ChunkSize}} <span title='chunk size differs from the cluster default of {{$.Config.ChunkSize}}MB'>({{ getStorageSize $value.MaxChunkSizeBytes }})</span>{{end}}</td>
+				<td align='left' class='break'><span title='shard key rated {{$value.Assessment.Rating}}'>{{ stringify $value.GetUserKey }}</span> {{getWarningSymbol (ne $value.Assessment.Rating "poor") }}</td>
 				<td align='center' class='break'>{{ getCheckMarkSymbol $value.Unique }}</td>
 				<td align='center' class='break'>{{ getCheckMarkSymbol $value.NoBalance }}</td>
 				<td align='right' class='break'>{{ numPrinter $value.Chunks }}</td>
-				<td align='center'><button class='btn'
-					onClick="javascript:loadData('/bond/chart/namespaces/{{$value.ID}}'); return false;">
-					<i class='fa fa-pie-chart' style='font-size: .8em;'></i></button></td>
+				<td align='right' class='break'><span title='{{if $value.Balance.SizeThreshold}}data size difference {{getStorageSize $value.Balance.SizeDifference}} (threshold {{getStorageSize $value.Balance.SizeThreshold}}){{else}}difference {{$value.Balance.Difference}} (threshold {{$value.Balance.Threshold}}){{end}}{{if $value.Zones}}, zoned{{end}}, CV {{printf "%.2f" $value.Balance.CV}}{{if $value.Balance.SizeSkew}}, size skew {{printf "%.2f" $value.Balance.SizeSkew}}{{end}}'>
+					{{ printf "%.0f%%" $value.Balance.Score }}</span> {{getWarningSymbol (not $value.Balance.IsImbalanced) }}</td>
+				<td align='center' class='break'>{{if $value.Compliance}}{{if $value.Compliance.BalancerCompliant}}{{getCheckMarkSymbol true}}{{else}}{{ $value.Compliance.FirstComplianceViolation }} {{getWarningSymbol false}}{{end}}{{else}}-{{end}}</td>
+				<td align='center'><a class='btn' href='{{pathURL "/bond/chart/namespaces/" $value.ID}}'>
+					<i class='fa fa-pie-chart' style='font-size: .8em;'></i></a>
+					<a class='btn' href='{{queryURL "/bond/charts/chunk_ownership" "ns" $value.ID}}'>
+					<i class='fa fa-line-chart' style='font-size: .8em;'></i></a></td>
 			</tr>
-		{{end}}
 	{{end}}
-{{end}}
-	</table></div>`
+	</table>
+	{{tablePager $q}}</div>
+{{end}}`
 
 	BondVideoHTML = `
 	<div style='float: left;'>
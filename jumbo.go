@@ -0,0 +1,319 @@
+/*
+ * Copyright 2023-present Kuei-chun Chen. All rights reserved.
+ * jumbo.go
+ */
+
+package bond
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/simagix/gox"
+	"github.com/simagix/keyhole/mdb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	JUMBO_REMEDY_TTL = 15 * time.Minute // remedies sized by dataSize are cached for this duration
+	MAX_JUMBO_CHUNKS = 1000
+
+	REMEDY_CLEAR_JUMBO_FLAG = "clearJumboFlag"
+	REMEDY_REFINE_SHARD_KEY = "refineCollectionShardKey"
+	REMEDY_SPLIT            = "split"
+	REMEDY_SPLIT_AT         = "splitAt"
+)
+
+// JumboChunk is a chunk flagged jumbo, size and number of documents are estimated by dataSize via a mongos
+type JumboChunk struct {
+	HasSize    bool   `bson:"hasSize"`
+	Max        bson.D `bson:"max"`
+	Min        bson.D `bson:"min"`
+	NS         string `bson:"ns"`
+	Objects    int64  `bson:"objects"`
+	Remedy     string `bson:"remedy"`
+	Shard      string `bson:"shard"`
+	Size       int64  `bson:"size"`
+	SplitPoint bson.D `bson:"splitPoint"`
+}
+
+// jumboRemedy is a cached remedy of a jumbo chunk sized by dataSize
+type jumboRemedy struct {
+	chunk    JumboChunk
+	computed time.Time
+}
+
+// GetJumboChunks returns up to MAX_JUMBO_CHUNKS chunks flagged jumbo, and true if there are more
+func (ptr *ConfigDB) GetJumboChunks() ([]JumboChunk, bool, error) {
+	log.Println("GetJumboChunks()")
+	ctx := context.Background()
+	opts := options.Find().SetLimit(MAX_JUMBO_CHUNKS + 1).
+		SetProjection(bson.D{{Key: "ns", Value: 1}, {Key: "uuid", Value: 1}, {Key: "shard", Value: 1}, {Key: "min", Value: 1}, {Key: "max", Value: 1}})
+	cursor, err := ptr.client.Database("config").Collection("chunks").Find(ctx, bson.D{{Key: "jumbo", Value: true}}, opts)
+	if err != nil {
+		return nil, false, err
+	}
+	defer cursor.Close(ctx)
+	chunks := []JumboChunk{}
+	truncated := false
+	for cursor.Next(ctx) {
+		var doc struct {
+			JumboChunk `bson:",inline"`
+			UUID       primitive.Binary `bson:"uuid"`
+		}
+		if err = cursor.Decode(&doc); err != nil {
+			continue
+		}
+		if len(chunks) == MAX_JUMBO_CHUNKS {
+			truncated = true
+			break
+		}
+		if doc.NS == "" {
+			doc.NS = ptr.uuid2NS[string(doc.UUID.Data)]
+		}
+		chunks = append(chunks, doc.JumboChunk)
+	}
+	return chunks, truncated, cursor.Err()
+}
+
+// GetJumboChunkRemedy estimates the size of a jumbo chunk and suggests a remedy. A chunk below the chunk size
+// only needs its jumbo flag cleared, a chunk of a hashed shard key splits at the middle of its bounds, otherwise
+// it splits at the median shard key, found by the server if not connected to a mongos. If the median is the lower bound, at least half of the documents share a
+// shard key value and the chunk can't be split without refining the shard key. Remedies sized by dataSize are cached
+// by chunk bounds for JUMBO_REMEDY_TTL.
+func (ptr *ConfigDB) GetJumboChunkRemedy(chunk *JumboChunk) {
+	coll := ptr.CollectionsMap[chunk.NS]
+	chunk.Remedy = REMEDY_SPLIT
+	if isHashedKey(coll.Key) {
+		return
+	}
+	if ptr.clusterType != mdb.Sharded {
+		return
+	}
+	toks := strings.SplitN(chunk.NS, ".", 2)
+	if len(toks) < 2 {
+		return
+	}
+	key := fmt.Sprintf("%v %v %v", chunk.NS, Stringify(chunk.Min), Stringify(chunk.Max))
+	if ptr.jumboRemedies != nil {
+		if cached, ok := ptr.jumboRemedies.Load(key); ok && time.Since(cached.(*jumboRemedy).computed) < JUMBO_REMEDY_TTL {
+			remedy := cached.(*jumboRemedy).chunk
+			chunk.HasSize, chunk.Objects, chunk.Remedy, chunk.Size, chunk.SplitPoint = remedy.HasSize, remedy.Objects,
+				remedy.Remedy, remedy.Size, remedy.SplitPoint
+			return
+		}
+		defer func() {
+			if chunk.HasSize {
+				ptr.jumboRemedies.Store(key, &jumboRemedy{chunk: *chunk, computed: time.Now()})
+			}
+		}()
+	}
+	ctx := context.Background()
+	var stats struct {
+		NumObjects int64 `bson:"numObjects"`
+		Size       int64 `bson:"size"`
+	}
+	err := ptr.client.Database(toks[0]).RunCommand(ctx, bson.D{{Key: "dataSize", Value: chunk.NS},
+		{Key: "keyPattern", Value: coll.Key}, {Key: "min", Value: chunk.Min}, {Key: "max", Value: chunk.Max},
+		{Key: "estimate", Value: true}}).Decode(&stats)
+	if err != nil {
+		log.Println("dataSize", chunk.NS, "error", err)
+		return
+	}
+	chunk.HasSize, chunk.Objects, chunk.Size = true, stats.NumObjects, stats.Size
+	if chunk.Size < int64(ptr.getChunkSize(&coll))*1024*1024 {
+		chunk.Remedy = REMEDY_CLEAR_JUMBO_FLAG
+		return
+	}
+
+	// median shard key of the chunk
+	projection := bson.D{{Key: "_id", Value: 0}}
+	for _, field := range coll.Key {
+		projection = append(projection, bson.E{Key: field.Key, Value: 1})
+	}
+	opts := options.FindOne().SetHint(coll.Key).SetMin(chunk.Min).SetMax(chunk.Max).
+		SetSkip(chunk.Objects / 2).SetProjection(projection)
+	var doc bson.M
+	if err = ptr.client.Database(toks[0]).Collection(toks[1]).FindOne(ctx, bson.D{}, opts).Decode(&doc); err != nil {
+		log.Println("find median", chunk.NS, "error", err)
+		return
+	}
+	middle := bson.D{}
+	for _, field := range coll.Key {
+		middle = append(middle, bson.E{Key: field.Key, Value: getValueByPath(doc, field.Key)})
+	}
+	a, _ := bson.Marshal(middle)
+	b, _ := bson.Marshal(chunk.Min)
+	if bytes.Equal(a, b) {
+		chunk.Remedy = REMEDY_REFINE_SHARD_KEY
+		return
+	}
+	chunk.Remedy, chunk.SplitPoint = REMEDY_SPLIT_AT, middle
+}
+
+// ClearJumboRemedies removes cached remedies of jumbo chunks, to be sized again by dataSize
+func (ptr *ConfigDB) ClearJumboRemedies() {
+	if ptr.jumboRemedies == nil {
+		return
+	}
+	ptr.jumboRemedies.Range(func(key, value interface{}) bool {
+		ptr.jumboRemedies.Delete(key)
+		return true
+	})
+}
+
+// isHashedKey returns true if any field of a shard key is hashed
+func isHashedKey(key bson.D) bool {
+	for _, field := range key {
+		if field.Value == "hashed" {
+			return true
+		}
+	}
+	return false
+}
+
+// getValueByPath returns value of a dotted path in a document, nil if not found
+func getValueByPath(doc bson.M, path string) interface{} {
+	var value interface{} = doc
+	for _, name := range strings.Split(path, ".") {
+		switch m := value.(type) {
+		case bson.M:
+			value = m[name]
+		case bson.D:
+			value = m.Map()[name]
+		default:
+			return nil
+		}
+	}
+	return value
+}
+
+// GetJumboScript returns a reviewable mongo shell script of remedies of jumbo chunks, total is the number of
+// jumbo chunks of which the chunks are a page
+func (ptr *ConfigDB) GetJumboScript(chunks []JumboChunk, total int) string {
+	lines := []string{
+		"// jumbo chunk remedies suggested by Chen's Bond, review before running; it is never executed by Bond.",
+		"// clearJumboFlag requires MongoDB 4.2.3 or 4.0.15+, refineCollectionShardKey requires 4.4+ and an index",
+		"// supporting the refined shard key.",
+	}
+	if len(chunks) == 0 {
+		lines = append(lines, "// no jumbo chunks were found.")
+	} else if total > len(chunks) {
+		lines = append(lines, fmt.Sprintf("// remedies of %d of %d jumbo chunks, see other pages of the jumbo chunks table for the rest.", len(chunks), total))
+	}
+	if version, err := strconv.ParseFloat(ptr.MajorVersion, 64); err == nil && version < 4.4 {
+		lines = append(lines, fmt.Sprintf("// refineCollectionShardKey is unavailable in MongoDB %v.", ptr.MongoVersion))
+	}
+	refined := map[string]bool{}
+	for _, chunk := range chunks {
+		bounds := fmt.Sprintf("[ %v, %v ]", Stringify(chunk.Min), Stringify(chunk.Max))
+		comment := fmt.Sprintf("// %v on %v, bounds %v", chunk.NS, chunk.Shard, bounds)
+		if name := GetUserNamespace(chunk.NS); name != chunk.NS {
+			comment = fmt.Sprintf("// buckets of time-series %v on %v, bounds %v", name, chunk.Shard, bounds)
+		}
+		if chunk.HasSize {
+			comment += fmt.Sprintf(", %v in %d documents", gox.GetStorageSize(float64(chunk.Size)), chunk.Objects)
+		}
+		lines = append(lines, "", comment)
+		switch chunk.Remedy {
+		case REMEDY_CLEAR_JUMBO_FLAG:
+			lines = append(lines, fmt.Sprintf(`db.adminCommand({ clearJumboFlag: "%v", bounds: %v });`, chunk.NS, bounds))
+		case REMEDY_SPLIT_AT:
+			lines = append(lines, fmt.Sprintf(`sh.splitAt("%v", %v);`, chunk.NS, Stringify(chunk.SplitPoint)))
+		case REMEDY_REFINE_SHARD_KEY:
+			key := append(bson.D{}, ptr.CollectionsMap[chunk.NS].Key...)
+			if key.Map()["_id"] == nil {
+				key = append(key, bson.E{Key: "_id", Value: 1})
+			}
+			if ptr.CollectionsMap[chunk.NS].IsTimeseries() {
+				lines = append(lines, "// at least half of the buckets share a shard key value, refineCollectionShardKey doesn't support time-series collections.")
+				continue
+			} else if refined[chunk.NS] {
+				lines = append(lines, "// see refineCollectionShardKey above")
+				continue
+			}
+			refined[chunk.NS] = true
+			lines = append(lines, "// at least half of the documents share a shard key value, add a suffix field to the shard key, e.g.")
+			lines = append(lines, fmt.Sprintf(`db.getSiblingDB("%v").getCollection("%v").createIndex(%v);`,
+				strings.SplitN(chunk.NS, ".", 2)[0], strings.SplitN(chunk.NS, ".", 2)[1], Stringify(key)))
+			lines = append(lines, fmt.Sprintf(`db.adminCommand({ refineCollectionShardKey: "%v", key: %v });`, chunk.NS, Stringify(key)))
+		default:
+			if isHashedKey(ptr.CollectionsMap[chunk.NS].Key) {
+				lines = append(lines, fmt.Sprintf(`db.adminCommand({ split: "%v", bounds: %v });`, chunk.NS, bounds))
+			} else { // splits at the median
+				lines = append(lines, fmt.Sprintf(`db.adminCommand({ split: "%v", find: %v });`, chunk.NS, Stringify(chunk.Min)))
+			}
+		}
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// GetJumboChunksPage returns a page of jumbo chunks, optionally of a shard by jumbo.shard
+func GetJumboChunksPage(r *http.Request, chunks []JumboChunk) ([]JumboChunk, *TableQuery) {
+	q := NewTableQuery(r, "jumbo", "ns", false)
+	if shard := r.URL.Query().Get("jumbo.shard"); shard != "" {
+		filtered := []JumboChunk{}
+		for _, chunk := range chunks {
+			if chunk.Shard == shard {
+				filtered = append(filtered, chunk)
+			}
+		}
+		chunks = filtered
+	}
+	docs := []JumboChunk{}
+	for _, i := range q.Apply(len(chunks), func(i int) string { return chunks[i].NS },
+		map[string]func(int) interface{}{
+			"ns":    func(i int) interface{} { return chunks[i].NS },
+			"shard": func(i int) interface{} { return chunks[i].Shard },
+			"min":   func(i int) interface{} { return Stringify(chunks[i].Min) },
+		}) {
+		docs = append(docs, chunks[i])
+	}
+	return docs, q
+}
+
+// GetJumboTemplate returns HTML of jumbo chunks
+func GetJumboTemplate() (*template.Template, error) {
+	html := GetContentHTML()
+	html += JumboHTML
+	html += "</body></html>"
+	return template.New("bond").Funcs(infoFuncMap()).Parse(html)
+}
+
+const (
+	// jumbo chunks
+	JumboHTML = `<div style='float: left; clear: left;'>
+	{{$q:=.JumboTable}}
+	<table><caption>Jumbo Chunks{{if .Shard}} on {{.Shard}}{{end}} ({{numPrinter $q.Total}}{{if .Truncated}} of the first {{numPrinter .MaxJumbo}} found, more are flagged jumbo{{end}})
+		<a href='{{$q.PageURL $q.Page}}&refresh=1' title='size chunks again by dataSize'><i class='fa fa-refresh'></i></a> <a href='/api/bond/v1.0/data/jumbo?jumbo.q={{$q.Search}}&jumbo.shard={{.Shard}}&jumbo.sort={{$q.Sort}}&jumbo.order={{if $q.Desc}}desc{{else}}asc{{end}}&jumbo.page={{$q.Page}}'
+		target='_blank' title='review the script of chunks of the page, it is never executed by Bond'><i class='fa fa-file-code-o'></i></a></caption><tr><th>#</th>
+	{{sortHeader $q "ns" "Namespace"}}{{sortHeader $q "shard" "Shard Name"}}{{sortHeader $q "min" "Min"}}<th>Max</th><th>Data Size</th><th>Documents</th><th>Remedy</th>
+	{{range $n, $value := .Jumbo}}
+			<tr>
+				<td align='right' class='break'>{{ add $q.Start (add $n 1) }}</td>
+				<td align='left' class='break'>{{ getUserNamespace $value.NS }}</td>
+				<td align='left' class='break'>{{ $value.Shard }}</td>
+				<td align='left' class='break'>{{ $.Config.GetUserBounds $value.NS $value.Min }}</td>
+				<td align='left' class='break'>{{ $.Config.GetUserBounds $value.NS $value.Max }}</td>
+			{{if $value.HasSize}}
+				<td align='right' class='break'>{{ getStorageSize $value.Size }}</td>
+				<td align='right' class='break'>{{ numPrinter $value.Objects }}</td>
+			{{else}}
+				<td align='right' class='break'>-</td>
+				<td align='right' class='break'>-</td>
+			{{end}}
+				<td align='left' class='break'>{{ $value.Remedy }}{{if $value.SplitPoint}} {{ $.Config.GetUserBounds $value.NS $value.SplitPoint }}{{end}}</td>
+			</tr>
+	{{end}}
+	</table>
+	{{tablePager $q}}</div>`
+)
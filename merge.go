@@ -0,0 +1,384 @@
+/*
+ * Copyright 2023-present Kuei-chun Chen. All rights reserved.
+ * merge.go
+ */
+
+package bond
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/simagix/gox"
+	"github.com/simagix/keyhole/mdb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	MAX_DATASIZE_CHUNKS = 1000             // maximum chunks of a batch sized by dataSize
+	MERGE_PLAN_TTL      = 15 * time.Minute // merge plans sized by dataSize are cached for this duration
+	MERGE_SMALL_RATIO   = 0.25             // chunks smaller than this ratio of the chunk size are merge candidates
+	MERGE_TARGET_RATIO  = 0.5              // merged chunks stay within this ratio of the chunk size
+
+	SIZING_AVERAGE   = "average"
+	SIZING_DATA_SIZE = "dataSize"
+)
+
+// ChunkMerge is a range of adjacent chunks on a shard to merge
+type ChunkMerge struct {
+	Chunks int    `bson:"chunks"`
+	Max    bson.D `bson:"max"`
+	Min    bson.D `bson:"min"`
+	Shard  string `bson:"shard"`
+	Size   int64  `bson:"size"`
+}
+
+// MergePlan is empty and undersized chunks of a collection and merges eliminating them. Sizes are from dataSize
+// of each chunk, of a batch of up to MAX_DATASIZE_CHUNKS chunks in shard key order. With the average chunk size of
+// each shard from collStats, only chunks eliminated are estimated, and nothing is known if sizing is empty.
+type MergePlan struct {
+	Batch       int          `bson:"batch"`
+	Batches     int          `bson:"batches"`
+	Chunks      int          `bson:"chunks"`
+	Computed    *time.Time   `bson:"computed"`
+	Eliminated  int          `bson:"eliminated"`
+	Empty       int          `bson:"empty"`
+	Merges      []ChunkMerge `bson:"merges"`
+	NS          string       `bson:"ns"`
+	Sizing      string       `bson:"sizing"`
+	Small       int          `bson:"small"`
+	TotalChunks int          `bson:"totalChunks"`
+}
+
+// GetFirstChunk returns the ordinal of the first chunk of the batch, from 1
+func (ptr *MergePlan) GetFirstChunk() int {
+	return ptr.Batch*MAX_DATASIZE_CHUNKS + 1
+}
+
+// GetMergeCandidates returns merge plans of up to TOP_N collections having the most chunks, sized by averages
+func (ptr *ConfigDB) GetMergeCandidates() ([]MergePlan, error) {
+	log.Println("GetMergeCandidates()")
+	colls := []ConfigCollection{}
+	for _, coll := range ptr.CollectionsMap {
+		if coll.Chunks > len(ptr.ShardsMap) {
+			colls = append(colls, coll)
+		}
+	}
+	sort.Slice(colls, func(i, j int) bool {
+		if colls[i].Chunks == colls[j].Chunks {
+			return colls[i].ID < colls[j].ID
+		}
+		return colls[i].Chunks > colls[j].Chunks
+	})
+	if len(colls) > TOP_N {
+		colls = colls[:TOP_N]
+	}
+	plans := []MergePlan{}
+	for _, coll := range colls {
+		plan, err := ptr.GetMergePlan(coll.ID, false, 0)
+		if err != nil {
+			return nil, err
+		}
+		plans = append(plans, *plan)
+	}
+	return plans, nil
+}
+
+// GetMergePlan finds empty and undersized chunks of a collection, and merges runs of adjacent ones on the same
+// shard in shard key order. Chunks are sized by dataSize if requested and connected to a mongos, in batches of
+// MAX_DATASIZE_CHUNKS chunks, and the plan of a batch is cached for MERGE_PLAN_TTL or until the number of chunks
+// changes. Otherwise, or if dataSize fails, chunks eliminated are estimated from average chunk sizes of shards,
+// which can't tell sizes of individual chunks, and no merges are suggested.
+func (ptr *ConfigDB) GetMergePlan(ns string, dataSize bool, batch int) (*MergePlan, error) {
+	log.Println("GetMergePlan()", ns, dataSize, batch)
+	coll, ok := ptr.CollectionsMap[ns]
+	if !ok {
+		return nil, fmt.Errorf("sharded collection %v not found", ns)
+	}
+	batches := int(math.Ceil(float64(coll.Chunks) / MAX_DATASIZE_CHUNKS))
+	if batch < 0 || (batch > 0 && batch >= batches) {
+		return nil, fmt.Errorf("batch %d out of range, %v has %d batches of %d chunks", batch, ns, batches, MAX_DATASIZE_CHUNKS)
+	}
+	plan := MergePlan{Chunks: coll.Chunks, NS: ns, TotalChunks: coll.Chunks}
+	chunkSize := int64(ptr.getChunkSize(&coll)) * 1024 * 1024
+	if dataSize && ptr.clusterType == mdb.Sharded {
+		key := fmt.Sprintf("%v#%d", ns, batch)
+		if ptr.mergePlans != nil {
+			if cached, ok := ptr.mergePlans.Load(key); ok {
+				if cachedPlan := cached.(*MergePlan); cachedPlan.TotalChunks == coll.Chunks && time.Since(*cachedPlan.Computed) < MERGE_PLAN_TTL {
+					return cachedPlan, nil
+				}
+				ptr.mergePlans.Delete(key)
+			}
+		}
+		chunks, err := ptr.getChunkRanges(&coll, batch)
+		if err != nil {
+			return nil, err
+		}
+		if err = ptr.getChunkDataSizes(&coll, chunks); err == nil {
+			computed := time.Now()
+			plan.Batch, plan.Batches, plan.Computed = batch, batches, &computed
+			plan.Chunks, plan.Sizing = len(chunks), SIZING_DATA_SIZE
+			plan.addMerges(chunks, chunkSize)
+			if ptr.mergePlans != nil {
+				ptr.mergePlans.Store(key, &plan)
+			}
+			return &plan, nil
+		}
+		log.Println("dataSize", ns, "error", err)
+	}
+	if len(coll.Balance.ShardSizes) > 0 {
+		plan.Sizing = SIZING_AVERAGE
+		plan.estimateMerges(&coll, chunkSize)
+	}
+	return &plan, nil
+}
+
+// ClearMergePlans removes cached merge plans of a collection, to be sized again by dataSize
+func (ptr *ConfigDB) ClearMergePlans(ns string) {
+	if ptr.mergePlans == nil {
+		return
+	}
+	ptr.mergePlans.Range(func(key, value interface{}) bool {
+		if value.(*MergePlan).NS == ns {
+			ptr.mergePlans.Delete(key)
+		}
+		return true
+	})
+}
+
+// getChunkDataSizes sizes chunks of a collection by dataSize
+func (ptr *ConfigDB) getChunkDataSizes(coll *ConfigCollection, chunks []ChunkMerge) error {
+	toks := strings.SplitN(coll.ID, ".", 2)
+	if len(toks) < 2 {
+		return fmt.Errorf("invalid namespace %v", coll.ID)
+	}
+	for i, chunk := range chunks {
+		var stats struct {
+			Size int64 `bson:"size"`
+		}
+		if err := ptr.client.Database(toks[0]).RunCommand(context.Background(), bson.D{{Key: "dataSize", Value: coll.ID},
+			{Key: "keyPattern", Value: coll.Key}, {Key: "min", Value: chunk.Min}, {Key: "max", Value: chunk.Max},
+			{Key: "estimate", Value: true}}).Decode(&stats); err != nil {
+			return err
+		}
+		chunks[i].Size = stats.Size
+	}
+	return nil
+}
+
+// estimateMerges estimates chunks eliminated if chunks of each shard were merged up to MERGE_TARGET_RATIO of the
+// chunk size, from the average chunk size of the shard
+func (ptr *MergePlan) estimateMerges(coll *ConfigCollection, chunkSize int64) {
+	for shard, n := range coll.shards {
+		size, ok := coll.Balance.ShardSizes[shard]
+		if !ok || n < 2 {
+			continue
+		}
+		target := int(math.Ceil(float64(size) / (MERGE_TARGET_RATIO * float64(chunkSize))))
+		if target < 1 {
+			target = 1
+		}
+		if n > target {
+			ptr.Eliminated += n - target
+		}
+	}
+}
+
+// addMerges merges runs of adjacent undersized chunks on the same shard, chunks are in shard key order
+func (ptr *MergePlan) addMerges(chunks []ChunkMerge, chunkSize int64) {
+	var merge *ChunkMerge
+	flush := func() {
+		if merge != nil && merge.Chunks > 1 {
+			ptr.Merges = append(ptr.Merges, *merge)
+			ptr.Eliminated += merge.Chunks - 1
+		}
+		merge = nil
+	}
+	for _, chunk := range chunks {
+		if chunk.Size == 0 {
+			ptr.Empty++
+		}
+		if float64(chunk.Size) >= MERGE_SMALL_RATIO*float64(chunkSize) {
+			flush()
+			continue
+		}
+		ptr.Small++
+		if merge == nil || merge.Shard != chunk.Shard || float64(merge.Size+chunk.Size) > MERGE_TARGET_RATIO*float64(chunkSize) {
+			flush()
+			merge = &ChunkMerge{Min: chunk.Min, Shard: chunk.Shard}
+		}
+		merge.Chunks++
+		merge.Max = chunk.Max
+		merge.Size += chunk.Size
+	}
+	flush()
+}
+
+// getChunkRanges returns a batch of up to MAX_DATASIZE_CHUNKS chunks of a collection in shard key order
+func (ptr *ConfigDB) getChunkRanges(coll *ConfigCollection, batch int) ([]ChunkMerge, error) {
+	ctx := context.Background()
+	chunks := ptr.client.Database("config").Collection("chunks")
+	filter := bson.D{{Key: "ns", Value: coll.ID}}
+	if ptr.isChunksByUUID() {
+		filter = bson.D{{Key: "uuid", Value: coll.UUID}}
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "min", Value: 1}}).
+		SetProjection(bson.D{{Key: "shard", Value: 1}, {Key: "min", Value: 1}, {Key: "max", Value: 1}}).
+		SetSkip(int64(batch * MAX_DATASIZE_CHUNKS)).SetLimit(MAX_DATASIZE_CHUNKS)
+	cursor, err := chunks.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	docs := []ChunkMerge{}
+	for cursor.Next(ctx) {
+		var doc ChunkMerge
+		if err = cursor.Decode(&doc); err != nil {
+			continue
+		}
+		doc.Chunks = 1
+		docs = append(docs, doc)
+	}
+	return docs, cursor.Err()
+}
+
+// GetMergeScript returns a reviewable mongo shell script of mergeChunks of a collection
+func (ptr *ConfigDB) GetMergeScript(plan *MergePlan) string {
+	lines := []string{
+		"// mergeChunks plan suggested by Chen's Bond, review before running; it is never executed by Bond.",
+		"// merge chunks while the balancer is stopped, or within a maintenance window.",
+	}
+	if version, err := strconv.ParseFloat(ptr.MajorVersion, 64); err == nil && version >= 7.0 {
+		lines = append(lines, "// since MongoDB 7.0, the AutoMerger merges adjacent chunks, or use mergeAllChunksOnShard.")
+	}
+	if plan.Sizing == "" {
+		lines = append(lines, "// chunk sizes are unknown, connect through a mongos.")
+	} else if plan.Sizing == SIZING_AVERAGE {
+		lines = append(lines, "// chunk sizes are estimated by averages of shards, no merges are suggested without dataSize of chunks.")
+	}
+	if name := GetUserNamespace(plan.NS); name != plan.NS {
+		lines = append(lines, fmt.Sprintf("// %v is a time-series collection, chunks are of buckets keyed on meta and control.min fields.", name))
+	}
+	if plan.Batches > 1 {
+		lines = append(lines, fmt.Sprintf("// chunks %d to %d of %d in shard key order, batch %d of %d.", plan.GetFirstChunk(),
+			plan.GetFirstChunk()+plan.Chunks-1, plan.TotalChunks, plan.Batch+1, plan.Batches))
+	}
+	if len(plan.Merges) == 0 && plan.Sizing == SIZING_DATA_SIZE {
+		lines = append(lines, fmt.Sprintf("// no chunks of %v to merge.", plan.NS))
+	}
+	for _, merge := range plan.Merges {
+		lines = append(lines, fmt.Sprintf(`db.adminCommand({ mergeChunks: "%v", bounds: [ %v, %v ] }); // %d chunks on %v, %v`,
+			plan.NS, Stringify(merge.Min), Stringify(merge.Max), merge.Chunks, merge.Shard, gox.GetStorageSize(float64(merge.Size))))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// GetChunkMergesPage returns a page of merges
+func GetChunkMergesPage(r *http.Request, merges []ChunkMerge) ([]ChunkMerge, *TableQuery) {
+	q := NewTableQuery(r, "merges", "chunks", true)
+	docs := []ChunkMerge{}
+	for _, i := range q.Apply(len(merges), func(i int) string { return merges[i].Shard },
+		map[string]func(int) interface{}{
+			"shard":  func(i int) interface{} { return merges[i].Shard },
+			"chunks": func(i int) interface{} { return merges[i].Chunks },
+			"size":   func(i int) interface{} { return merges[i].Size },
+		}) {
+		docs = append(docs, merges[i])
+	}
+	return docs, q
+}
+
+// GetMergesTemplate returns HTML of chunk merge plans
+func GetMergesTemplate() (*template.Template, error) {
+	html := GetContentHTML()
+	html += MergesHTML
+	html += "</body></html>"
+	return template.New("bond").Funcs(infoFuncMap()).Parse(html)
+}
+
+const (
+	// chunk merge candidates and plan of a collection
+	MergesHTML = `<div style='float: left; clear: left;'>
+{{if .Plan}}
+	{{$plan:=.Plan}}
+	<table width=400px><caption>Chunks Merge of {{getUserNamespace $plan.NS}} <a href='/api/bond/v1.0/data/merge?ns={{$plan.NS}}&batch={{$plan.Batch}}' target='_blank'
+		title='review the script, it is never executed by Bond'><i class='fa fa-file-code-o'></i></a></caption><tr><th>Metric</th><th>Value</th>
+		<tr><td align='left' class='rowtitle'>Chunks</td><td align='right' class='break'>{{ numPrinter $plan.Chunks }}</td></tr>
+	{{if gt $plan.Batches 1}}
+		<tr><td align='left' class='rowtitle'>Batch</td><td align='right' class='break'>
+			{{if gt $plan.Batch 0}}<a href='/bond/merges?ns={{$plan.NS}}&batch={{add $plan.Batch -1}}'><i class='fa fa-angle-left'></i></a>{{end}}
+			chunks {{ numPrinter $plan.GetFirstChunk }}-{{ numPrinter (add $plan.GetFirstChunk (add $plan.Chunks -1)) }} of {{ numPrinter $plan.TotalChunks }}
+			{{if lt (add $plan.Batch 1) $plan.Batches}}<a href='/bond/merges?ns={{$plan.NS}}&batch={{add $plan.Batch 1}}'><i class='fa fa-angle-right'></i></a>{{end}}</td></tr>
+	{{end}}
+	{{if $plan.Computed}}
+		<tr><td align='left' class='rowtitle'>Sized at</td><td align='right' class='break'>{{ ISOTime $plan.Computed }}
+			<a href='/bond/merges?ns={{$plan.NS}}&batch={{$plan.Batch}}&refresh=1' title='size chunks again by dataSize'><i class='fa fa-refresh'></i></a></td></tr>
+	{{end}}
+	{{if eq $plan.Sizing "dataSize"}}
+		<tr><td align='left' class='rowtitle'>Empty Chunks</td><td align='right' class='break'>{{ numPrinter $plan.Empty }}</td></tr>
+		<tr><td align='left' class='rowtitle'>Undersized Chunks</td><td align='right' class='break'>{{ numPrinter $plan.Small }}</td></tr>
+		<tr><td align='left' class='rowtitle'>Chunks Eliminated by Merges</td><td align='right' class='break'>{{ numPrinter $plan.Eliminated }}</td></tr>
+	{{else if $plan.Sizing}}
+		<tr><td align='left' class='rowtitle'>Chunks Eliminated by Merges</td><td align='right' class='break'>~{{ numPrinter $plan.Eliminated }} (estimate, no merges suggested)</td></tr>
+	{{end}}
+		<tr><td align='left' class='rowtitle'>Sizing</td><td align='right' class='break'>{{if $plan.Sizing}}{{$plan.Sizing}}{{else}}unknown, connect through a mongos{{end}}</td></tr>
+	</table></div>
+
+	<div style='float: left;'>
+	{{$q:=.MergesTable}}
+	<table><caption>Suggested Merges ({{numPrinter $q.Total}})</caption><tr><th>#</th>
+	{{sortHeader $q "shard" "Shard Name"}}<th>Min</th><th>Max</th>{{sortHeader $q "chunks" "Chunks"}}{{sortHeader $q "size" "Data Size"}}
+	{{range $n, $value := .Merges}}
+			<tr>
+				<td align='right' class='break'>{{ add $q.Start (add $n 1) }}</td>
+				<td align='left' class='break'>{{ $value.Shard }}</td>
+				<td align='left' class='break'>{{ $.Config.GetUserBounds $plan.NS $value.Min }}</td>
+				<td align='left' class='break'>{{ $.Config.GetUserBounds $plan.NS $value.Max }}</td>
+				<td align='right' class='break'>{{ numPrinter $value.Chunks }}</td>
+				<td align='right' class='break'>{{ getStorageSize $value.Size }}</td>
+			</tr>
+	{{end}}
+	</table>
+	{{tablePager $q}}
+{{else}}
+	<table><caption>Chunks Merge Candidates</caption><tr><th>#</th>
+	<th>Namespace</th><th>Chunks</th><th>Empty</th><th>Undersized</th><th>Eliminated by Merges</th><th>Sizing</th><th>-</th>
+	{{range $n, $value := .Plans}}
+			<tr>
+				<td align='right' class='break'>{{ add $n 1 }}</td>
+				<td align='left' class='break'>{{ getUserNamespace $value.NS }}</td>
+				<td align='right' class='break'>{{ numPrinter $value.Chunks }}</td>
+			{{if eq $value.Sizing "dataSize"}}
+				<td align='right' class='break'>{{ numPrinter $value.Empty }}</td>
+				<td align='right' class='break'>{{ numPrinter $value.Small }}</td>
+				<td align='right' class='break'>{{ numPrinter $value.Eliminated }} {{getWarningSymbol (eq $value.Eliminated 0) }}</td>
+				<td align='left' class='break'>{{ $value.Sizing }}</td>
+			{{else if $value.Sizing}}
+				<td align='right' class='break'>-</td>
+				<td align='right' class='break'>-</td>
+				<td align='right' class='break'>~{{ numPrinter $value.Eliminated }}</td>
+				<td align='left' class='break'>{{ $value.Sizing }} estimate</td>
+			{{else}}
+				<td align='right' class='break'>-</td>
+				<td align='right' class='break'>-</td>
+				<td align='right' class='break'>-</td>
+				<td align='left' class='break'>unknown</td>
+			{{end}}
+				<td align='center'><a class='btn' href='{{queryURL "/bond/merges" "ns" $value.NS}}'>
+					<i class='fa fa-compress' style='font-size: .8em;'></i></a></td>
+			</tr>
+	{{end}}
+	</table>
+{{end}}
+	</div>`
+)
@@ -0,0 +1,55 @@
+/*
+ * Copyright 2023-present Kuei-chun Chen. All rights reserved.
+ * merge_test.go
+ */
+
+package bond
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestAddMerges(t *testing.T) {
+	mb := int64(1024 * 1024)
+	tests := []struct {
+		shards     string  // shards of chunks in shard key order
+		sizes      []int64 // sizes of chunks in MB
+		merges     []int   // chunks of merges
+		eliminated int
+		empty      int
+		small      int
+	}{
+		{"aaaaa", []int64{0, 0, 10, 20, 100}, []int{4}, 3, 2, 4},
+		{"aaabb", []int64{0, 0, 0, 5, 5}, []int{3, 2}, 3, 3, 5},
+		{"aaaa", []int64{0, 100, 0, 100}, nil, 0, 2, 2},
+		{"aaaaa", []int64{30, 30, 30, 30, 30}, []int{2, 2}, 2, 0, 5},
+		{"abab", []int64{0, 0, 0, 0}, nil, 0, 4, 4},
+		{"", nil, nil, 0, 0, 0},
+	}
+	for n, tc := range tests {
+		chunks := []ChunkMerge{}
+		for i, size := range tc.sizes {
+			chunks = append(chunks, ChunkMerge{Chunks: 1, Min: bson.D{{Key: "k", Value: i}}, Max: bson.D{{Key: "k", Value: i + 1}},
+				Shard: tc.shards[i : i+1], Size: size * mb})
+		}
+		plan := MergePlan{Chunks: len(chunks), NS: "db.coll", Sizing: SIZING_DATA_SIZE}
+		plan.addMerges(chunks, DEFAULT_CHUNK_SIZE_MB*mb)
+		if plan.Eliminated != tc.eliminated || plan.Empty != tc.empty || plan.Small != tc.small {
+			t.Errorf("#%d eliminated %d, empty %d, small %d, want %d, %d, %d", n, plan.Eliminated, plan.Empty, plan.Small,
+				tc.eliminated, tc.empty, tc.small)
+		}
+		if len(plan.Merges) != len(tc.merges) {
+			t.Fatalf("#%d %d merges, want %d", n, len(plan.Merges), len(tc.merges))
+		}
+		for i, merge := range plan.Merges {
+			if merge.Chunks != tc.merges[i] {
+				t.Errorf("#%d merge %d of %d chunks, want %d", n, i, merge.Chunks, tc.merges[i])
+			}
+			if float64(merge.Size) > MERGE_TARGET_RATIO*float64(DEFAULT_CHUNK_SIZE_MB*mb) {
+				t.Errorf("#%d merge %d of %d bytes exceeds the target", n, i, merge.Size)
+			}
+		}
+	}
+}
@@ -0,0 +1,339 @@
+/*
+ * Copyright 2023-present Kuei-chun Chen. All rights reserved.
+ * migrations.go
+ */
+
+package bond
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// donor and recipient events of a migration are logged within this period
+	MIGRATION_EVENTS_WINDOW = 10 * time.Minute
+)
+
+// Migration is a chunk migration reconstructed from moveChunk.* events, times are in milliseconds
+type Migration struct {
+	Bytes           int64              `bson:"bytes"`
+	CatchUp         int64              `bson:"catchUp"`
+	Clone           int64              `bson:"clone"`
+	Commit          int64              `bson:"commit"`
+	CriticalSection int64              `bson:"criticalSection"`
+	Docs            int64              `bson:"docs"`
+	Duration        int64              `bson:"duration"`
+	From            string             `bson:"from"`
+	NS              string             `bson:"ns"`
+	Success         bool               `bson:"success"`
+	Time            primitive.DateTime `bson:"time"`
+	To              string             `bson:"to"`
+}
+
+// MigrationTally summarizes migrations of a namespace or of a donor and recipient pair
+type MigrationTally struct {
+	AverageDuration int64  `bson:"averageDuration"`
+	Bytes           int64  `bson:"bytes"`
+	Docs            int64  `bson:"docs"`
+	Name            string `bson:"name"`
+	Total           int    `bson:"total"`
+}
+
+type MigrationStats struct {
+	Aborted                int              `bson:"aborted"`
+	AverageCatchUp         int64            `bson:"averageCatchUp"`
+	AverageClone           int64            `bson:"averageClone"`
+	AverageCommit          int64            `bson:"averageCommit"`
+	AverageCriticalSection int64            `bson:"averageCriticalSection"`
+	Bytes                  int64            `bson:"bytes"`
+	Docs                   int64            `bson:"docs"`
+	Namespaces             []MigrationTally `bson:"namespaces"`
+	P50                    int64            `bson:"p50"`
+	P95                    int64            `bson:"p95"`
+	P99                    int64            `bson:"p99"`
+	ShardPairs             []MigrationTally `bson:"shardPairs"`
+	Succeeded              int              `bson:"succeeded"`
+	Total                  int              `bson:"total"`
+}
+
+type moveChunkEvent struct {
+	Details bson.M             `bson:"details"`
+	NS      string             `bson:"ns"`
+	Time    primitive.DateTime `bson:"time"`
+	What    string             `bson:"what"`
+
+	min  bson.Raw // lower bound in stored field order, details.min of bson.M is unordered
+	used bool
+}
+
+// GetMigrations reconstructs chunk migrations from moveChunk.start, moveChunk.from, moveChunk.to, and moveChunk.commit events
+func (ptr *ChangeLog) GetMigrations() error {
+	log.Println("ChangeLog.GetMigrations()")
+	filter := bson.D{
+		{Key: "what", Value: bson.D{
+			{Key: "$in", Value: bson.A{"moveChunk.start", "moveChunk.from", "moveChunk.to", "moveChunk.commit"}},
+		}},
+		{Key: "time", Value: GetTimeRangeFilter(ptr.since, ptr.until)},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "time", Value: 1}}).
+		SetProjection(bson.D{{Key: "what", Value: 1}, {Key: "ns", Value: 1}, {Key: "time", Value: 1}, {Key: "details", Value: 1}})
+	ctx := context.Background()
+	cursor, err := ptr.client.Database("config").Collection("changelog").Find(ctx, filter, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	donors := []*moveChunkEvent{}
+	others := map[string][]*moveChunkEvent{}
+	for cursor.Next(ctx) {
+		var doc moveChunkEvent
+		if err = cursor.Decode(&doc); err != nil {
+			continue
+		}
+		var bounds struct {
+			Details struct {
+				Min bson.Raw `bson:"min"`
+			} `bson:"details"`
+		}
+		if err = cursor.Decode(&bounds); err == nil {
+			doc.min = bounds.Details.Min
+		}
+		if doc.What == "moveChunk.from" {
+			donors = append(donors, &doc)
+		} else {
+			key := doc.What + "/" + getMoveChunkKey(&doc)
+			others[key] = append(others[key], &doc)
+		}
+	}
+
+	ptr.Migrations = []Migration{}
+	for _, donor := range donors {
+		key := getMoveChunkKey(donor)
+		migration := Migration{From: getString(donor.Details["from"]), NS: donor.NS,
+			Success: true, Time: donor.Time, To: getString(donor.Details["to"])}
+		if note := getString(donor.Details["note"]); note != "" && note != "success" {
+			migration.Success = false
+		}
+		// donor steps: 3 clone and catch-up, 4 enter critical section, 5 commit on recipient, 6 commit on config
+		for n := 1; n <= 6; n++ {
+			migration.Duration += getMoveChunkStep(donor.Details, n)
+		}
+		migration.CriticalSection = getMoveChunkStep(donor.Details, 4) + getMoveChunkStep(donor.Details, 5)
+		migration.Commit = getMoveChunkStep(donor.Details, 6)
+		if start := findMoveChunkEvent(others["moveChunk.start/"+key], donor.Time); start != nil && migration.Duration == 0 {
+			migration.Duration = int64(donor.Time - start.Time)
+		}
+		// recipient steps: 3 initial clone, 4 catch-up
+		if recipient := findMoveChunkEvent(others["moveChunk.to/"+key], donor.Time); recipient != nil {
+			migration.Clone = getMoveChunkStep(recipient.Details, 3)
+			migration.CatchUp = getMoveChunkStep(recipient.Details, 4)
+		}
+		if commit := findMoveChunkEvent(others["moveChunk.commit/"+key], donor.Time); commit != nil {
+			if counts, ok := commit.Details["counts"].(bson.M); ok {
+				migration.Docs = ToInt64(counts["cloned"])
+				migration.Bytes = ToInt64(counts["clonedBytes"])
+			}
+		}
+		ptr.Migrations = append(ptr.Migrations, migration)
+	}
+	ptr.MigrationStats = GetMigrationStats(ptr.Migrations)
+	return nil
+}
+
+// GetMigrationStats returns totals, tallies, average step times, and latency percentiles of migrations
+func GetMigrationStats(migrations []Migration) MigrationStats {
+	stats := MigrationStats{Total: len(migrations)}
+	namespaces := map[string]*MigrationTally{}
+	pairs := map[string]*MigrationTally{}
+	durations := []int64{}
+	var clone, catchUp, criticalSection, commit int64
+	for _, migration := range migrations {
+		if !migration.Success {
+			stats.Aborted++
+			continue
+		}
+		stats.Succeeded++
+		stats.Docs += migration.Docs
+		stats.Bytes += migration.Bytes
+		clone += migration.Clone
+		catchUp += migration.CatchUp
+		criticalSection += migration.CriticalSection
+		commit += migration.Commit
+		durations = append(durations, migration.Duration)
+		tallyMigration(namespaces, migration.NS, migration)
+		tallyMigration(pairs, fmt.Sprintf("%v → %v", migration.From, migration.To), migration)
+	}
+	if stats.Succeeded > 0 {
+		n := int64(stats.Succeeded)
+		stats.AverageClone, stats.AverageCatchUp = clone/n, catchUp/n
+		stats.AverageCriticalSection, stats.AverageCommit = criticalSection/n, commit/n
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	stats.P50 = GetPercentile(durations, 50)
+	stats.P95 = GetPercentile(durations, 95)
+	stats.P99 = GetPercentile(durations, 99)
+	for _, tally := range namespaces {
+		tally.AverageDuration /= int64(tally.Total)
+		stats.Namespaces = append(stats.Namespaces, *tally)
+	}
+	for _, tally := range pairs {
+		tally.AverageDuration /= int64(tally.Total)
+		stats.ShardPairs = append(stats.ShardPairs, *tally)
+	}
+	return stats
+}
+
+// tallyMigration adds a migration to a tally, average duration is a sum until divided by total
+func tallyMigration(tallies map[string]*MigrationTally, name string, migration Migration) {
+	tally, ok := tallies[name]
+	if !ok {
+		tally = &MigrationTally{Name: name}
+		tallies[name] = tally
+	}
+	tally.Total++
+	tally.Docs += migration.Docs
+	tally.Bytes += migration.Bytes
+	tally.AverageDuration += migration.Duration
+}
+
+// GetPercentile returns the nearest-rank percentile of sorted values
+func GetPercentile(sorted []int64, p float64) int64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+// getMoveChunkKey identifies a migration by namespace, chunk lower bound, donor, and recipient
+func getMoveChunkKey(doc *moveChunkEvent) string {
+	return strings.Join([]string{doc.NS, doc.min.String(),
+		getString(doc.Details["from"]), getString(doc.Details["to"])}, "/")
+}
+
+// findMoveChunkEvent returns the unused event closest in time
+func findMoveChunkEvent(events []*moveChunkEvent, t primitive.DateTime) *moveChunkEvent {
+	var found *moveChunkEvent
+	var delta time.Duration
+	for _, event := range events {
+		d := event.Time.Time().Sub(t.Time())
+		if d < 0 {
+			d = -d
+		}
+		if event.used || d > MIGRATION_EVENTS_WINDOW {
+			continue
+		}
+		if found == nil || d < delta {
+			found, delta = event, d
+		}
+	}
+	if found != nil {
+		found.used = true
+	}
+	return found
+}
+
+// getMoveChunkStep returns milliseconds of "step n of m" in details
+func getMoveChunkStep(details bson.M, n int) int64 {
+	prefix := fmt.Sprintf("step %d of ", n)
+	for key, value := range details {
+		if strings.HasPrefix(key, prefix) {
+			return ToInt64(value)
+		}
+	}
+	return 0
+}
+
+func getString(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// GetMigrationTalliesPage returns a page of migration tallies
+func GetMigrationTalliesPage(r *http.Request, name string, tallies []MigrationTally) ([]MigrationTally, *TableQuery) {
+	q := NewTableQuery(r, name, "total", true)
+	docs := []MigrationTally{}
+	for _, i := range q.Apply(len(tallies), func(i int) string { return tallies[i].Name },
+		map[string]func(int) interface{}{
+			"name":            func(i int) interface{} { return tallies[i].Name },
+			"total":           func(i int) interface{} { return tallies[i].Total },
+			"docs":            func(i int) interface{} { return tallies[i].Docs },
+			"bytes":           func(i int) interface{} { return tallies[i].Bytes },
+			"averageDuration": func(i int) interface{} { return tallies[i].AverageDuration },
+		}) {
+		docs = append(docs, tallies[i])
+	}
+	return docs, q
+}
+
+const (
+	// migrations summary
+	MigrationsHTML = `
+{{if gt .Config.Changes.MigrationStats.Total 0}}
+	{{$stats := .Config.Changes.MigrationStats}}
+	<div style='float: left;'>
+		<table width=400px><caption>Chunk Migrations</caption><tr><th>Metric</th><th>Value</th>
+			<tr><td align='left' class='rowtitle'>Migrations Succeeded</td><td align='right' class='break'>{{ numPrinter $stats.Succeeded }}</td></tr>
+			<tr><td align='left' class='rowtitle'>Migrations Aborted</td><td align='right' class='break'>{{ numPrinter $stats.Aborted }} {{getWarningSymbol (eq $stats.Aborted 0) }}</td></tr>
+			<tr><td align='left' class='rowtitle'>Documents Cloned</td><td align='right' class='break'>{{ numPrinter $stats.Docs }}</td></tr>
+			<tr><td align='left' class='rowtitle'>Bytes Cloned</td><td align='right' class='break'>{{ getStorageSize $stats.Bytes }}</td></tr>
+			<tr><td align='left' class='rowtitle'>Average Clone Time</td><td align='right' class='break'>{{ getDurationFromMilliseconds $stats.AverageClone }}</td></tr>
+			<tr><td align='left' class='rowtitle'>Average Catch-up Time</td><td align='right' class='break'>{{ getDurationFromMilliseconds $stats.AverageCatchUp }}</td></tr>
+			<tr><td align='left' class='rowtitle'>Average Critical Section Time</td><td align='right' class='break'>{{ getDurationFromMilliseconds $stats.AverageCriticalSection }}</td></tr>
+			<tr><td align='left' class='rowtitle'>Average Commit Time</td><td align='right' class='break'>{{ getDurationFromMilliseconds $stats.AverageCommit }}</td></tr>
+			<tr><td align='left' class='rowtitle'>Migration Latency p50</td><td align='right' class='break'>{{ getDurationFromMilliseconds $stats.P50 }}</td></tr>
+			<tr><td align='left' class='rowtitle'>Migration Latency p95</td><td align='right' class='break'>{{ getDurationFromMilliseconds $stats.P95 }}</td></tr>
+			<tr><td align='left' class='rowtitle'>Migration Latency p99</td><td align='right' class='break'>{{ getDurationFromMilliseconds $stats.P99 }}</td></tr>
+		</table></div>
+
+	<div style='float: left;'>
+	{{$q:=.MigrationNamespacesTable}}
+	<table><caption>Migrations per Namespace ({{numPrinter $q.Total}})</caption><tr><th>#</th>
+	{{sortHeader $q "name" "Namespace"}}{{sortHeader $q "total" "Migrations"}}{{sortHeader $q "docs" "Documents"}}{{sortHeader $q "bytes" "Bytes"}}{{sortHeader $q "averageDuration" "Average Time"}}
+	{{range $n, $value := .MigrationNamespaces}}
+			<tr>
+				<td align='right' class='break'>{{ add $q.Start (add $n 1) }}</td>
+				<td align='left' class='break'>{{ getUserNamespace $value.Name }}</td>
+				<td align='right' class='break'>{{ numPrinter $value.Total }}</td>
+				<td align='right' class='break'>{{ numPrinter $value.Docs }}</td>
+				<td align='right' class='break'>{{ getStorageSize $value.Bytes }}</td>
+				<td align='right' class='break'>{{ getDurationFromMilliseconds $value.AverageDuration }}</td>
+			</tr>
+	{{end}}
+	</table>
+	{{tablePager $q}}</div>
+
+	<div style='float: left;'>
+	{{$q:=.MigrationShardPairsTable}}
+	<table><caption>Migrations per Donor → Recipient ({{numPrinter $q.Total}})</caption><tr><th>#</th>
+	{{sortHeader $q "name" "Donor → Recipient"}}{{sortHeader $q "total" "Migrations"}}{{sortHeader $q "docs" "Documents"}}{{sortHeader $q "bytes" "Bytes"}}{{sortHeader $q "averageDuration" "Average Time"}}
+	{{range $n, $value := .MigrationShardPairs}}
+			<tr>
+				<td align='right' class='break'>{{ add $q.Start (add $n 1) }}</td>
+				<td align='left' class='break'>{{ $value.Name }}</td>
+				<td align='right' class='break'>{{ numPrinter $value.Total }}</td>
+				<td align='right' class='break'>{{ numPrinter $value.Docs }}</td>
+				<td align='right' class='break'>{{ getStorageSize $value.Bytes }}</td>
+				<td align='right' class='break'>{{ getDurationFromMilliseconds $value.AverageDuration }}</td>
+			</tr>
+	{{end}}
+	</table>
+	{{tablePager $q}}</div>
+{{end}}`
+)
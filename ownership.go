@@ -0,0 +1,207 @@
+/*
+ * Copyright 2023-present Kuei-chun Chen. All rights reserved.
+ * ownership.go
+ */
+
+package bond
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ChunkDelta is the net change of number of chunks of a collection on a shard within a minute
+type ChunkDelta struct {
+	Delta int                `bson:"delta"`
+	NS    string             `bson:"ns"`
+	Shard string             `bson:"shard"`
+	Time  primitive.DateTime `bson:"time"`
+}
+
+// ChunkOwnership is number of chunks by shards after changes of a minute
+type ChunkOwnership struct {
+	Shards map[string]int
+	Time   time.Time
+}
+
+// GetChunkDeltas aggregates chunk count changes from moveChunk.commit, split, multi-split, and merge events by minute.
+// Events after until are included because ownership history is reconstructed backward from the current chunks.
+func (ptr *ChangeLog) GetChunkDeltas() error {
+	log.Println("ChangeLog.GetChunkDeltas()")
+	owner := bson.D{{Key: "$ifNull", Value: bson.A{"$details.owningShard", "$shard"}}}
+	pipeline := bson.A{
+		bson.D{
+			{Key: "$match", Value: bson.D{
+				{Key: "what", Value: bson.D{
+					{Key: "$in", Value: bson.A{"moveChunk.commit", "split", "multi-split", "merge"}},
+				}},
+				{Key: "time", Value: GetTimeRangeFilter(ptr.since, nil)},
+			}},
+		},
+		bson.D{
+			{Key: "$project", Value: bson.D{
+				{Key: "_id", Value: 0},
+				{Key: "ns", Value: 1},
+				{Key: "minute", Value: bson.D{
+					{Key: "$dateToString", Value: bson.D{
+						{Key: "format", Value: "%Y-%m-%dT%H:%M:00.000Z"},
+						{Key: "date", Value: "$time"},
+					}},
+				}},
+				{Key: "changes", Value: bson.D{
+					{Key: "$switch", Value: bson.D{
+						{Key: "branches", Value: bson.A{
+							bson.D{
+								{Key: "case", Value: bson.D{{Key: "$eq", Value: bson.A{"$what", "moveChunk.commit"}}}},
+								{Key: "then", Value: bson.A{
+									bson.D{{Key: "shard", Value: "$details.from"}, {Key: "delta", Value: -1}},
+									bson.D{{Key: "shard", Value: "$details.to"}, {Key: "delta", Value: 1}},
+								}},
+							},
+							bson.D{
+								{Key: "case", Value: bson.D{{Key: "$eq", Value: bson.A{"$what", "split"}}}},
+								{Key: "then", Value: bson.A{
+									bson.D{{Key: "shard", Value: owner}, {Key: "delta", Value: 1}},
+								}},
+							},
+							// a multi-split logs an event per resulting chunk, numbered from 1
+							bson.D{
+								{Key: "case", Value: bson.D{{Key: "$eq", Value: bson.A{"$what", "multi-split"}}}},
+								{Key: "then", Value: bson.A{
+									bson.D{{Key: "shard", Value: owner}, {Key: "delta", Value: bson.D{
+										{Key: "$cond", Value: bson.A{
+											bson.D{{Key: "$gt", Value: bson.A{"$details.number", 1}}}, 1, 0},
+										}},
+									}},
+								}},
+							},
+						}},
+						// merge, merged chunks are listed in details.merged before 6.0 and counted by details.numChunks
+						// since, events of neither are counted as no change
+						{Key: "default", Value: bson.A{
+							bson.D{{Key: "shard", Value: owner}, {Key: "delta", Value: bson.D{
+								{Key: "$subtract", Value: bson.A{1, bson.D{
+									{Key: "$cond", Value: bson.A{
+										bson.D{{Key: "$isArray", Value: "$details.merged"}},
+										bson.D{{Key: "$size", Value: "$details.merged"}},
+										bson.D{{Key: "$ifNull", Value: bson.A{"$details.numChunks", 1}}},
+									}},
+								}}},
+							}}},
+						}},
+					}},
+				}},
+			}},
+		},
+		bson.D{{Key: "$unwind", Value: "$changes"}},
+		bson.D{
+			{Key: "$group", Value: bson.D{
+				{Key: "_id", Value: bson.D{
+					{Key: "minute", Value: "$minute"},
+					{Key: "ns", Value: "$ns"},
+					{Key: "shard", Value: "$changes.shard"},
+				}},
+				{Key: "delta", Value: bson.D{{Key: "$sum", Value: "$changes.delta"}}},
+			}},
+		},
+		bson.D{{Key: "$match", Value: bson.D{{Key: "delta", Value: bson.D{{Key: "$ne", Value: 0}}}}}},
+		bson.D{
+			{Key: "$project", Value: bson.D{
+				{Key: "_id", Value: 0},
+				{Key: "time", Value: bson.D{{Key: "$toDate", Value: "$_id.minute"}}},
+				{Key: "ns", Value: "$_id.ns"},
+				{Key: "shard", Value: "$_id.shard"},
+				{Key: "delta", Value: 1},
+			}},
+		},
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "time", Value: 1}}}},
+	}
+	ctx := context.Background()
+	db := ptr.client.Database("config")
+	opts := options.Aggregate().SetAllowDiskUse(true)
+	cursor, err := db.Collection("changelog").Aggregate(ctx, pipeline, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var doc ChunkDelta
+		if err = cursor.Decode(&doc); err != nil {
+			log.Println("decode chunk delta error", err)
+			continue
+		}
+		ptr.ChunkDeltas = append(ptr.ChunkDeltas, doc)
+	}
+	if err = cursor.Err(); err != nil {
+		return err
+	}
+
+	// merge events of unknown shapes
+	filter := bson.D{
+		{Key: "what", Value: "merge"},
+		{Key: "time", Value: GetTimeRangeFilter(ptr.since, nil)},
+		{Key: "details.merged", Value: bson.D{{Key: "$not", Value: bson.D{{Key: "$type", Value: "array"}}}}},
+		{Key: "details.numChunks", Value: bson.D{{Key: "$exists", Value: false}}},
+	}
+	unknown, err := db.Collection("changelog").CountDocuments(ctx, filter)
+	if err != nil {
+		log.Println("count merge events error", err)
+	} else if unknown > 0 {
+		log.Println(unknown, "merge events have neither details.merged nor details.numChunks, chunk ownership may drift from config.chunks")
+	}
+	return nil
+}
+
+// GetChunkOwnership reconstructs number of chunks by shards over time of a collection, or of all collections if ns
+// is empty, by undoing chunk changes from the current config.chunks. Only currently sharded collections are counted.
+// The first entry is the ownership before the earliest change.
+func (ptr *ConfigDB) GetChunkOwnership(ns string) []ChunkOwnership {
+	current := map[string]int{}
+	for name := range ptr.ShardsMap {
+		current[name] = 0
+	}
+	for _, chunk := range ptr.Chunks {
+		if ns == "" || chunk.NS == ns {
+			current[chunk.Shard] += chunk.Chunks
+		}
+	}
+	deltas := []ChunkDelta{}
+	if ptr.Changes != nil {
+		for _, delta := range ptr.Changes.ChunkDeltas {
+			if _, ok := ptr.CollectionsMap[delta.NS]; ok && (ns == "" || delta.NS == ns) {
+				deltas = append(deltas, delta)
+			}
+		}
+	}
+	history := []ChunkOwnership{}
+	copyShards := func() map[string]int {
+		shards := map[string]int{}
+		for name, chunks := range current {
+			if chunks < 0 { // history beyond a drop and re-shard of the collection
+				chunks = 0
+			}
+			shards[name] = chunks
+		}
+		return shards
+	}
+	for i := len(deltas) - 1; i >= 0; i-- {
+		t := deltas[i].Time.Time()
+		if len(history) == 0 || !history[len(history)-1].Time.Equal(t) {
+			history = append(history, ChunkOwnership{Shards: copyShards(), Time: t})
+		}
+		current[deltas[i].Shard] -= deltas[i].Delta
+	}
+	if len(history) > 0 {
+		history = append(history, ChunkOwnership{Shards: copyShards(), Time: history[len(history)-1].Time.Add(-time.Minute)})
+	}
+	sort.Slice(history, func(i, j int) bool {
+		return history[i].Time.Before(history[j].Time)
+	})
+	return history
+}
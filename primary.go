@@ -0,0 +1,277 @@
+/*
+ * Copyright 2023-present Kuei-chun Chen. All rights reserved.
+ * primary.go
+ */
+
+package bond
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/simagix/gox"
+	"github.com/simagix/keyhole/mdb"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	PRIMARY_SKEW_RATIO = 1.5
+)
+
+type PrimaryShard struct {
+	Databases     []string `bson:"databases"`
+	IsOverloaded  bool     `bson:"isOverloaded"`
+	Shard         string   `bson:"shard"`
+	UnshardedSize int64    `bson:"unshardedSize"`
+	Unsized       []string `bson:"unsized"` // databases of unknown unsharded data sizes
+}
+
+type MovePrimary struct {
+	Database string `bson:"database"`
+	From     string `bson:"from"`
+	Size     int64  `bson:"size"`
+	To       string `bson:"to"`
+}
+
+// GetPrimaryShardsInfo tallies databases and unsharded data by primary shard and suggests a movePrimary plan
+func (ptr *ConfigDB) GetPrimaryShardsInfo() error {
+	log.Println("GetPrimaryShardsInfo()")
+	primaries := map[string]*PrimaryShard{}
+	for name := range ptr.ShardsMap {
+		primaries[name] = &PrimaryShard{Shard: name}
+	}
+	sizes := map[string]int64{}
+	for _, db := range ptr.Databases {
+		primary, ok := primaries[db.Primary]
+		if !ok || db.ID == "admin" || db.ID == "config" {
+			continue
+		}
+		primary.Databases = append(primary.Databases, db.ID)
+		if ptr.clusterType != mdb.Sharded { // dbStats requires a mongos
+			primary.Unsized = append(primary.Unsized, db.ID)
+			continue
+		}
+		size, err := ptr.getUnshardedSize(db.ID)
+		if err != nil { // size unknown, e.g. not authorized or sharded collections without data sizes
+			log.Println("unsharded size", db.ID, "error", err)
+			primary.Unsized = append(primary.Unsized, db.ID)
+			continue
+		}
+		sizes[db.ID] = size
+		primary.UnshardedSize += size
+	}
+
+	ptr.PrimaryShards = []PrimaryShard{}
+	var totalDBs int
+	var totalSize int64
+	for _, primary := range primaries {
+		totalDBs += len(primary.Databases)
+		totalSize += primary.UnshardedSize
+	}
+	nshards := len(primaries)
+	for _, primary := range primaries {
+		if nshards > 1 {
+			fairDBs := float64(totalDBs) / float64(nshards)
+			fairSize := float64(totalSize) / float64(nshards)
+			if len(primary.Databases) > 1 && float64(len(primary.Databases)) > PRIMARY_SKEW_RATIO*fairDBs {
+				primary.IsOverloaded = true
+			} else if primary.UnshardedSize > 0 && float64(primary.UnshardedSize) > PRIMARY_SKEW_RATIO*fairSize {
+				primary.IsOverloaded = true
+			}
+		}
+		ptr.PrimaryShards = append(ptr.PrimaryShards, *primary)
+	}
+	sort.Slice(ptr.PrimaryShards, func(i, j int) bool {
+		return ptr.PrimaryShards[i].Shard < ptr.PrimaryShards[j].Shard
+	})
+	draining := map[string]bool{}
+	for name, shard := range ptr.ShardsMap {
+		draining[name] = shard.IsDraining()
+	}
+	ptr.MovePrimaryPlan = GetMovePrimaryPlan(ptr.PrimaryShards, sizes, draining)
+	return nil
+}
+
+// getUnshardedSize returns unsharded data size of a database, data size by dbStats less sizes of sharded
+// collections. The size is unknown if any sharded collection has no data sizes.
+func (ptr *ConfigDB) getUnshardedSize(name string) (int64, error) {
+	var sharded int64
+	prefix := name + "."
+	for ns, coll := range ptr.CollectionsMap {
+		if !strings.HasPrefix(ns, prefix) || coll.Chunks == 0 {
+			continue
+		}
+		if len(coll.Balance.ShardSizes) == 0 {
+			return 0, fmt.Errorf("data sizes of sharded collection %v unknown", ns)
+		}
+		for _, shardSize := range coll.Balance.ShardSizes {
+			sharded += shardSize
+		}
+	}
+	var doc bson.M
+	if err := ptr.client.Database(name).RunCommand(context.Background(), bson.D{{Key: "dbStats", Value: 1}}).Decode(&doc); err != nil {
+		return 0, err
+	}
+	size := ToInt64(doc["dataSize"]) - sharded
+	if size < 0 {
+		size = 0
+	}
+	return size, nil
+}
+
+// GetMovePrimaryPlan moves all databases off draining shards to the primary shards of the least unsharded data,
+// and then evens out unsharded data among the other primary shards until none exceeds PRIMARY_SKEW_RATIO times
+// the fair share, moving the database closing the gap the most while it at least halves the gap. Databases of
+// unknown sizes are moved only off draining shards. If no sizes are known, it evens out number of databases by moving the smallest first.
+func GetMovePrimaryPlan(primaries []PrimaryShard, sizes map[string]int64, draining map[string]bool) []MovePrimary {
+	plan := []MovePrimary{}
+	remaining := []PrimaryShard{}
+	for _, primary := range primaries {
+		if !draining[primary.Shard] {
+			remaining = append(remaining, primary)
+		}
+	}
+	if len(primaries) < 2 || len(remaining) == 0 {
+		return plan
+	}
+	dbs := map[string][]string{}
+	loads := map[string]int64{}
+	var total int64
+	for _, primary := range primaries {
+		list := append([]string{}, primary.Databases...)
+		sort.Slice(list, func(i, j int) bool {
+			if sizes[list[i]] == sizes[list[j]] {
+				return list[i] < list[j]
+			}
+			return sizes[list[i]] < sizes[list[j]]
+		})
+		dbs[primary.Shard] = list
+		for _, name := range list {
+			loads[primary.Shard] += sizes[name]
+			total += sizes[name]
+		}
+	}
+	less := func(a string, b string) bool { // less unsharded data, then fewer databases
+		if loads[a] != loads[b] {
+			return loads[a] < loads[b]
+		}
+		return len(dbs[a]) < len(dbs[b])
+	}
+	move := func(i int, from string, to string) {
+		name := dbs[from][i]
+		dbs[from] = append(dbs[from][:i:i], dbs[from][i+1:]...)
+		dbs[to] = append(dbs[to], name)
+		loads[from] -= sizes[name]
+		loads[to] += sizes[name]
+		plan = append(plan, MovePrimary{Database: name, From: from, Size: sizes[name], To: to})
+	}
+	for _, primary := range primaries {
+		if !draining[primary.Shard] {
+			continue
+		}
+		for len(dbs[primary.Shard]) > 0 {
+			to := remaining[0].Shard
+			for _, other := range remaining {
+				if less(other.Shard, to) {
+					to = other.Shard
+				}
+			}
+			move(len(dbs[primary.Shard])-1, primary.Shard, to) // the largest first
+		}
+	}
+	primaries = remaining
+	fair := float64(total) / float64(len(primaries))
+	for {
+		from, to := primaries[0].Shard, primaries[0].Shard
+		for _, primary := range primaries {
+			if less(from, primary.Shard) {
+				from = primary.Shard
+			}
+			if less(primary.Shard, to) {
+				to = primary.Shard
+			}
+		}
+		if total == 0 {
+			if len(dbs[from])-len(dbs[to]) <= 1 {
+				break
+			}
+			move(0, from, to)
+			continue
+		}
+		if float64(loads[from]) <= PRIMARY_SKEW_RATIO*fair {
+			break
+		}
+		gap := loads[from] - loads[to]
+		best := -1
+		for i, name := range dbs[from] { // the gap after the move is |gap - 2*size|
+			if size := sizes[name]; size > 0 && (best < 0 || abs64(gap-2*size) < abs64(gap-2*sizes[dbs[from][best]])) {
+				best = i
+			}
+		}
+		if best < 0 || 2*abs64(gap-2*sizes[dbs[from][best]]) > gap { // not worth a movePrimary
+			break
+		}
+		move(best, from, to)
+	}
+	return plan
+}
+
+func abs64(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// GetMovePrimaryScript returns a reviewable mongo shell script of the movePrimary plan
+func GetMovePrimaryScript(plan []MovePrimary) string {
+	lines := []string{
+		"// movePrimary plan suggested by Chen's Bond, review before running; it is never executed by Bond.",
+		"// movePrimary copies all unsharded collections of a database to the new primary shard,",
+		"// run it during a maintenance window and follow the documented steps of your MongoDB version.",
+	}
+	if len(plan) == 0 {
+		lines = append(lines, "// primary shards are evenly distributed, nothing to move.")
+	}
+	for _, mp := range plan {
+		lines = append(lines, fmt.Sprintf(`db.adminCommand({ movePrimary: "%v", to: "%v" }); // from %v, unsharded data %v`,
+			mp.Database, mp.To, mp.From, gox.GetStorageSize(float64(mp.Size))))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// GetPrimaryShardsPage returns a page of primary shards
+func GetPrimaryShardsPage(r *http.Request, primaries []PrimaryShard) ([]PrimaryShard, *TableQuery) {
+	q := NewTableQuery(r, "primaries", "shard", false)
+	docs := []PrimaryShard{}
+	for _, i := range q.Apply(len(primaries), func(i int) string { return primaries[i].Shard },
+		map[string]func(int) interface{}{
+			"shard":         func(i int) interface{} { return primaries[i].Shard },
+			"databases":     func(i int) interface{} { return len(primaries[i].Databases) },
+			"unshardedSize": func(i int) interface{} { return primaries[i].UnshardedSize },
+		}) {
+		docs = append(docs, primaries[i])
+	}
+	return docs, q
+}
+
+// GetMovePrimaryPlanPage returns a page of the movePrimary plan, in the plan order by default
+func GetMovePrimaryPlanPage(r *http.Request, plan []MovePrimary) ([]MovePrimary, *TableQuery) {
+	q := NewTableQuery(r, "movePrimary", "step", false)
+	docs := []MovePrimary{}
+	for _, i := range q.Apply(len(plan), func(i int) string { return plan[i].Database },
+		map[string]func(int) interface{}{
+			"step":     func(i int) interface{} { return i },
+			"database": func(i int) interface{} { return plan[i].Database },
+			"from":     func(i int) interface{} { return plan[i].From },
+			"to":       func(i int) interface{} { return plan[i].To },
+			"size":     func(i int) interface{} { return plan[i].Size },
+		}) {
+		docs = append(docs, plan[i])
+	}
+	return docs, q
+}
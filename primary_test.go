@@ -0,0 +1,61 @@
+/*
+ * Copyright 2023-present Kuei-chun Chen. All rights reserved.
+ * primary_test.go
+ */
+
+package bond
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestGetMovePrimaryPlan(t *testing.T) {
+	gb := int64(1024 * 1024 * 1024)
+	tests := []struct {
+		primaries []PrimaryShard
+		sizes     map[string]int64
+		draining  map[string]bool
+		want      []string // database:from>to in the plan order
+	}{
+		{ // a single primary shard
+			[]PrimaryShard{{Shard: "a", Databases: []string{"a1", "a2"}}},
+			map[string]int64{"a1": gb, "a2": gb}, nil, []string{},
+		},
+		{ // evenly distributed
+			[]PrimaryShard{{Shard: "a", Databases: []string{"a1"}}, {Shard: "b", Databases: []string{"b1"}}},
+			map[string]int64{"a1": gb, "b1": 2 * gb}, nil, []string{},
+		},
+		{ // the database closest to half the gap moves
+			[]PrimaryShard{{Shard: "a", Databases: []string{"a1", "a2", "a3"}}, {Shard: "b", Databases: []string{"b1"}}},
+			map[string]int64{"a1": 5 * gb, "a2": 2 * gb, "a3": 10 * gb, "b1": gb}, nil, []string{"a3:a>b"},
+		},
+		{ // no sizes, by number of databases
+			[]PrimaryShard{{Shard: "a", Databases: []string{"a1", "a2", "a3", "a4"}}, {Shard: "b"}},
+			map[string]int64{}, nil, []string{"a1:a>b", "a2:a>b"},
+		},
+		{ // a draining shard moves all, the largest first to the least loaded, then with fewer databases
+			[]PrimaryShard{{Shard: "a", Databases: []string{"a1"}}, {Shard: "b", Databases: []string{"b1"}},
+				{Shard: "c", Databases: []string{"c1", "c2"}}},
+			map[string]int64{"a1": 3 * gb, "b1": gb, "c1": gb, "c2": 2 * gb}, map[string]bool{"c": true},
+			[]string{"c2:c>b", "c1:c>a"},
+		},
+		{ // all shards draining
+			[]PrimaryShard{{Shard: "a", Databases: []string{"a1"}}, {Shard: "b", Databases: []string{"b1"}}},
+			map[string]int64{}, map[string]bool{"a": true, "b": true}, []string{},
+		},
+	}
+	for n, tc := range tests {
+		plan := GetMovePrimaryPlan(tc.primaries, tc.sizes, tc.draining)
+		got := []string{}
+		for _, mp := range plan {
+			got = append(got, fmt.Sprintf("%v:%v>%v", mp.Database, mp.From, mp.To))
+			if mp.Size != tc.sizes[mp.Database] {
+				t.Errorf("#%d %v size %d, want %d", n, mp.Database, mp.Size, tc.sizes[mp.Database])
+			}
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Errorf("#%d plan %v, want %v", n, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+/*
+ * Copyright 2023-present Kuei-chun Chen. All rights reserved.
+ * shardkey.go
+ */
+
+package bond
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	RATING_FAIR = "fair"
+	RATING_GOOD = "good"
+	RATING_POOR = "poor"
+)
+
+const noIssuesExplanation = "No issues were found from the key pattern, verify cardinality and frequency of values."
+
+var (
+	lowCardinalityRe = regexp.MustCompile(`(?i)^(active|category|country|currency|deleted|enabled|flag|gender|kind|lang|language|level|priority|region|state|status|type)$`)
+	monotonicRe      = regexp.MustCompile(`^(?i:_id|ts|date|datetime|time|timestamp|created|updated)$|[a-z](Date|Time|Timestamp)$|_(?i:date|time|timestamp)$|[a-z]At$|_at$`)
+)
+
+// ShardKeyAssessment rates a shard key, explanations are reasons of the rating. The leading field type is sampled
+// and supporting indexes of shards are checked on the collection page when connected to a mongos.
+type ShardKeyAssessment struct {
+	Explanations []string        `bson:"explanations"`
+	IsHashed     bool            `bson:"isHashed"`
+	IsMonotonic  bool            `bson:"isMonotonic"`
+	LeadingType  string          `bson:"leadingType"`
+	Rating       string          `bson:"rating"`
+	ShardIndexes map[string]bool `bson:"shardIndexes"`
+}
+
+// AssessShardKeys rates shard keys of all collections from key patterns and jumbo chunks
+func (ptr *ConfigDB) AssessShardKeys() {
+	log.Println("AssessShardKeys()")
+	jumbo := map[string]int{}
+	for _, chunk := range ptr.Chunks {
+		jumbo[chunk.NS] += chunk.Jumbo
+	}
+	for ns, coll := range ptr.CollectionsMap {
+		coll.Assessment = assessCollectionShardKey(&coll, jumbo[ns], "", nil)
+		ptr.CollectionsMap[ns] = coll
+	}
+}
+
+// AssessShardKey rates a shard key. A ranged key leading by a sampled ObjectId or date is monotonic and sends all
+// inserts to the chunk of the max key, a leading field named like a date or _id is only likely monotonic. A single field key likely of low cardinality, or having jumbo chunks,
+// can't be split finely. In a compound key, a monotonic leading field defeats the other fields, while a
+// leading low cardinality field followed by others is a good pattern. The leading type is of a sampled
+// document and indexes are supporting indexes by shards, both are optional.
+func AssessShardKey(key bson.D, jumbo int, leadingType string, indexes map[string]bool) ShardKeyAssessment {
+	assessment := ShardKeyAssessment{Explanations: []string{}, LeadingType: leadingType, Rating: RATING_GOOD, ShardIndexes: indexes}
+	if len(key) == 0 {
+		return assessment
+	}
+	poor := 0
+	rate := func(rating string, explanation string) { // poor explanations go first
+		if rating == RATING_POOR {
+			assessment.Rating = rating
+			assessment.Explanations = append(assessment.Explanations[:poor], append([]string{explanation}, assessment.Explanations[poor:]...)...)
+			poor++
+			return
+		} else if rating == RATING_FAIR && assessment.Rating == RATING_GOOD {
+			assessment.Rating = rating
+		}
+		assessment.Explanations = append(assessment.Explanations, explanation)
+	}
+	leading := key[0].Key
+	name := leading[strings.LastIndex(leading, ".")+1:]
+	assessment.IsHashed = isHashedKey(key)
+	likely := false // monotonic by the field name, type not sampled
+	switch leadingType {
+	case "objectId", "date", "timestamp":
+		assessment.IsMonotonic = true
+	case "":
+		likely = monotonicRe.MatchString(name)
+	}
+	if key[0].Value == "hashed" {
+		assessment.IsMonotonic, likely = false, false
+	}
+
+	if assessment.IsHashed {
+		rate(RATING_GOOD, "Hashed key distributes inserts evenly, range queries on the key are broadcast to all shards.")
+	} else if assessment.IsMonotonic && len(key) == 1 {
+		rate(RATING_POOR, fmt.Sprintf("Ranged key on %v is monotonically increasing, all inserts go to the chunk of the max key on a single shard.", leading))
+	} else if assessment.IsMonotonic {
+		rate(RATING_POOR, fmt.Sprintf("Compound key leads with monotonically increasing %v, other fields can't spread inserts.", leading))
+	} else if likely && len(key) == 1 {
+		rate(RATING_FAIR, fmt.Sprintf("Ranged key on %v is likely monotonically increasing by its name, verify its type on the collection page.", leading))
+	} else if likely {
+		rate(RATING_FAIR, fmt.Sprintf("Compound key likely leads with monotonically increasing %v by its name, verify its type on the collection page.", leading))
+	}
+	if len(key) == 1 && lowCardinalityRe.MatchString(name) {
+		rate(RATING_POOR, fmt.Sprintf("Single field key on %v likely has low cardinality, chunks of a value can't be split.", leading))
+	} else if len(key) == 1 && jumbo > 0 && leading != "_id" {
+		rate(RATING_POOR, fmt.Sprintf("Single field key has %d jumbo chunks, likely of low cardinality or frequent values.", jumbo))
+	} else if jumbo > 0 {
+		rate(RATING_FAIR, fmt.Sprintf("Compound key has %d jumbo chunks, consider refining the key with a higher cardinality suffix.", jumbo))
+	}
+	if len(key) > 1 && !assessment.IsMonotonic && !likely {
+		if lowCardinalityRe.MatchString(name) {
+			rate(RATING_GOOD, fmt.Sprintf("Compound key groups documents by %v and splits them by %v.", leading, key[1].Key))
+		}
+		for _, field := range key[1:] {
+			if field.Key == "_id" || monotonicRe.MatchString(field.Key[strings.LastIndex(field.Key, ".")+1:]) {
+				rate(RATING_GOOD, fmt.Sprintf("Compound key suffix %v adds cardinality to documents of a %v value.", field.Key, leading))
+				break
+			}
+		}
+	}
+	shards := []string{}
+	for shard, ok := range indexes {
+		if !ok {
+			shards = append(shards, shard)
+		}
+	}
+	sort.Strings(shards)
+	if len(shards) > 0 {
+		rate(RATING_POOR, fmt.Sprintf("No index supports the shard key on %v.", strings.Join(shards, ", ")))
+	}
+	if len(assessment.Explanations) == 0 {
+		rate(RATING_GOOD, noIssuesExplanation)
+	}
+	return assessment
+}
+
+// assessCollectionShardKey rates the shard key of a collection, a time-series collection is rated on
+// user-facing fields of which the time field is monotonic
+func assessCollectionShardKey(coll *ConfigCollection, jumbo int, leadingType string, indexes map[string]bool) ShardKeyAssessment {
+	if coll.TimeseriesFields == nil {
+		return AssessShardKey(coll.Key, jumbo, leadingType, indexes)
+	}
+	key := coll.GetUserKey()
+	if len(key) > 0 && key[0].Key == coll.TimeseriesFields.TimeField {
+		leadingType = "date"
+	}
+	assessment := AssessShardKey(key, jumbo, leadingType, indexes)
+	assessTimeseriesKey(coll, &assessment)
+	return assessment
+}
+
+// getLeadingType returns BSON type of the leading shard key field of a sampled document
+func (ptr *ConfigDB) getLeadingType(coll *ConfigCollection) (string, error) {
+	toks := strings.SplitN(coll.ID, ".", 2)
+	if len(toks) < 2 || len(coll.Key) == 0 {
+		return "", nil
+	}
+	leading := coll.Key[0].Key
+	opts := options.FindOne().SetProjection(bson.D{{Key: "_id", Value: 0}, {Key: leading, Value: 1}})
+	var doc bson.M
+	err := ptr.client.Database(toks[0]).Collection(toks[1]).FindOne(context.Background(), bson.D{}, opts).Decode(&doc)
+	if err != nil {
+		return "", err
+	}
+	switch getValueByPath(doc, leading).(type) {
+	case primitive.ObjectID:
+		return "objectId", nil
+	case primitive.DateTime:
+		return "date", nil
+	case primitive.Timestamp:
+		return "timestamp", nil
+	case string:
+		return "string", nil
+	case int32, int64, float64, primitive.Decimal128:
+		return "number", nil
+	case nil:
+		return "missing", nil
+	}
+	return "other", nil
+}
+
+// getShardIndexes returns if an index supports the shard key by shards owning chunks of a collection
+func (ptr *ConfigDB) getShardIndexes(coll *ConfigCollection) (map[string]bool, error) {
+	toks := strings.SplitN(coll.ID, ".", 2)
+	if len(toks) < 2 {
+		return nil, nil
+	}
+	ctx := context.Background()
+	cursor, err := ptr.client.Database(toks[0]).Collection(toks[1]).Aggregate(ctx, bson.A{
+		bson.D{{Key: "$indexStats", Value: bson.D{}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	indexes := map[string]bool{}
+	for shard, chunks := range coll.shards {
+		if chunks > 0 {
+			indexes[shard] = false
+		}
+	}
+	for cursor.Next(ctx) {
+		var doc struct {
+			Key   bson.D `bson:"key"`
+			Shard string `bson:"shard"`
+			Spec  bson.M `bson:"spec"`
+		}
+		if err = cursor.Decode(&doc); err != nil {
+			continue
+		}
+		if _, ok := indexes[doc.Shard]; !ok || doc.Spec["partialFilterExpression"] != nil || doc.Spec["sparse"] == true {
+			continue
+		}
+		if isIndexPrefix(coll.Key, doc.Key) {
+			indexes[doc.Shard] = true
+		}
+	}
+	defer cursor.Close(ctx)
+	return indexes, nil
+}
+
+// isIndexPrefix returns true if a shard key is a prefix of an index key
+func isIndexPrefix(key bson.D, index bson.D) bool {
+	if len(index) < len(key) {
+		return false
+	}
+	for i, field := range key {
+		if field.Key != index[i].Key || fmt.Sprintf("%v", field.Value) != fmt.Sprintf("%v", index[i].Value) {
+			return false
+		}
+	}
+	return true
+}
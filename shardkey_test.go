@@ -0,0 +1,47 @@
+/*
+ * Copyright 2023-present Kuei-chun Chen. All rights reserved.
+ * shardkey_test.go
+ */
+
+package bond
+
+import (
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestAssessShardKey(t *testing.T) {
+	tests := []struct {
+		key         bson.D
+		jumbo       int
+		leadingType string
+		indexes     map[string]bool
+		rating      string
+		explanation string // a substring of the first explanation
+	}{
+		{bson.D{{Key: "_id", Value: "hashed"}}, 0, "", nil, RATING_GOOD, "Hashed key"},
+		{bson.D{{Key: "userId", Value: 1}}, 0, "objectId", nil, RATING_POOR, "monotonically increasing"},
+		{bson.D{{Key: "createdAt", Value: 1}}, 0, "", nil, RATING_FAIR, "likely monotonically increasing"},
+		{bson.D{{Key: "createdAt", Value: 1}, {Key: "userId", Value: 1}}, 0, "date", nil, RATING_POOR, "Compound key leads with"},
+		{bson.D{{Key: "status", Value: 1}}, 0, "", nil, RATING_POOR, "low cardinality"},
+		{bson.D{{Key: "sku", Value: 1}}, 3, "string", nil, RATING_POOR, "3 jumbo chunks"},
+		{bson.D{{Key: "sku", Value: 1}, {Key: "store", Value: 1}}, 2, "string", nil, RATING_FAIR, "refining the key"},
+		{bson.D{{Key: "region", Value: 1}, {Key: "_id", Value: 1}}, 0, "string", nil, RATING_GOOD, "groups documents by region"},
+		{bson.D{{Key: "sku", Value: 1}}, 0, "string", map[string]bool{"shard0": true, "shard1": false}, RATING_POOR, "No index supports the shard key on shard1"},
+		{bson.D{{Key: "sku", Value: 1}}, 0, "string", nil, RATING_GOOD, noIssuesExplanation},
+		{bson.D{}, 0, "", nil, RATING_GOOD, ""},
+	}
+	for _, tc := range tests {
+		assessment := AssessShardKey(tc.key, tc.jumbo, tc.leadingType, tc.indexes)
+		first := ""
+		if len(assessment.Explanations) > 0 {
+			first = assessment.Explanations[0]
+		}
+		if assessment.Rating != tc.rating || !strings.Contains(first, tc.explanation) {
+			t.Errorf("AssessShardKey(%v, %d, %q) = %v %q, want %v %q", Stringify(tc.key), tc.jumbo, tc.leadingType,
+				assessment.Rating, first, tc.rating, tc.explanation)
+		}
+	}
+}
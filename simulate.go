@@ -0,0 +1,304 @@
+/*
+ * Copyright 2023-present Kuei-chun Chen. All rights reserved.
+ * simulate.go
+ */
+
+package bond
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/simagix/gox"
+)
+
+const (
+	MAX_SIMULATED_ROUNDS   = 1000000
+	MAX_SIMULATED_SHARDS   = 100 // maximum shards to add
+	SIZING_CHUNKS          = "chunks"
+	SHORT_ROUND_INTERVAL   = time.Second // balancer sleep after a round moving chunks
+	SIMULATED_SHARD_PREFIX = "new-shard-"
+)
+
+// CollectionSimulation is simulated migrations of a collection, blocked chunks are on a draining shard
+// of a collection having balancing disabled
+type CollectionSimulation struct {
+	After      map[string]int
+	Before     map[string]int
+	Blocked    int
+	Migrations int
+	NS         string
+
+	sizes map[string]int64 // data sizes by shards of a data size balanced simulation
+}
+
+// Simulation is the result of simulating the balancer after adding shards or draining a shard
+type Simulation struct {
+	Add         int
+	Collections []CollectionSimulation
+	Drain       string
+	ETA         time.Duration
+	Migrations  int
+	MsPerRound  float64
+	Rounds      int
+	Shards      []string
+	Sizing      string
+	Unsized     int
+}
+
+// Simulate simulates the balancer after adding shards, draining a shard, or both. In each round, a shard takes part
+// in at most one migration, and a collection migrates chunks from the most to the least loaded shards while the
+// difference reaches its migration threshold, chunks on a draining shard always move. Before 6.0, shards are
+// loaded by chunks and the threshold is by number of chunks. Since 6.0, shards are loaded by data sizes from
+// collStats, a migration moves a chunk of the average chunk size of the donor, and the threshold is 3 times the
+// chunk size; collections without data sizes are not simulated. The time to reach balance is estimated from
+// rounds moving chunks in the actionlog, or from the median migration time.
+func (ptr *ConfigDB) Simulate(add int, drain string) (*Simulation, error) {
+	log.Println("Simulate()", add, drain)
+	if add < 0 || add > MAX_SIMULATED_SHARDS {
+		return nil, fmt.Errorf("invalid number of shards to add %v, up to %d", add, MAX_SIMULATED_SHARDS)
+	}
+	if _, ok := ptr.ShardsMap[drain]; drain != "" && !ok {
+		return nil, fmt.Errorf("shard %v not found", drain)
+	}
+	sim := Simulation{Add: add, Drain: drain, Sizing: SIZING_CHUNKS}
+	if ptr.isDataSizeBalanced() {
+		sim.Sizing = SIZING_DATA_SIZE
+	}
+	for name := range ptr.ShardsMap {
+		sim.Shards = append(sim.Shards, name)
+	}
+	sort.Strings(sim.Shards)
+	for i := 1; i <= add; i++ {
+		sim.Shards = append(sim.Shards, fmt.Sprintf("%v%d", SIMULATED_SHARD_PREFIX, i))
+	}
+	if drain != "" && len(sim.Shards) < 2 {
+		return nil, fmt.Errorf("no shards to migrate chunks from %v to", drain)
+	}
+
+	names := []string{}
+	for ns := range ptr.CollectionsMap {
+		names = append(names, ns)
+	}
+	sort.Strings(names)
+	for _, ns := range names {
+		coll := ptr.CollectionsMap[ns]
+		if coll.Chunks == 0 {
+			continue
+		}
+		cs := CollectionSimulation{After: map[string]int{}, Before: map[string]int{}, NS: ns}
+		if sim.Sizing == SIZING_DATA_SIZE {
+			if len(coll.Balance.ShardSizes) == 0 {
+				sim.Unsized++
+				continue
+			}
+			cs.sizes = map[string]int64{}
+		}
+		for _, name := range sim.Shards {
+			cs.Before[name] = coll.shards[name]
+			cs.After[name] = coll.shards[name]
+			if cs.sizes != nil {
+				cs.sizes[name] = coll.Balance.ShardSizes[name]
+			}
+		}
+		if coll.NoBalance {
+			cs.Blocked = cs.After[drain]
+		}
+		sim.Collections = append(sim.Collections, cs)
+	}
+
+	for sim.Rounds < MAX_SIMULATED_ROUNDS {
+		busy := map[string]bool{}
+		moved := 0
+		for i := range sim.Collections {
+			cs := &sim.Collections[i]
+			coll := ptr.CollectionsMap[cs.NS]
+			if coll.NoBalance {
+				continue
+			}
+			threshold := float64(GetMigrationThreshold(coll.Chunks))
+			load := func(name string) float64 { return float64(cs.After[name]) }
+			if cs.sizes != nil {
+				threshold = float64(3 * int64(ptr.getChunkSize(&coll)) * 1024 * 1024)
+				load = func(name string) float64 { return float64(cs.sizes[name]) }
+			}
+			for {
+				donor, recipient := "", ""
+				for _, name := range sim.Shards {
+					if busy[name] {
+						continue
+					}
+					if name == drain {
+						if cs.After[name] > 0 {
+							donor = name
+						}
+						continue
+					}
+					if recipient == "" || load(name) < load(recipient) {
+						recipient = name
+					}
+					if (donor == "" || donor != drain) && cs.After[name] > 0 && (donor == "" || load(name) > load(donor)) {
+						donor = name
+					}
+				}
+				if donor == "" || recipient == "" || donor == recipient {
+					break
+				}
+				if donor != drain && load(donor)-load(recipient) < threshold {
+					break
+				}
+				if cs.sizes != nil {
+					size := cs.sizes[donor] / int64(cs.After[donor])
+					if donor != drain && float64(size) > load(donor)-load(recipient) { // would not even out
+						break
+					}
+					cs.sizes[donor] -= size
+					cs.sizes[recipient] += size
+				}
+				cs.After[donor]--
+				cs.After[recipient]++
+				cs.Migrations++
+				busy[donor], busy[recipient] = true, true
+				moved++
+			}
+		}
+		if moved == 0 {
+			break
+		}
+		sim.Migrations += moved
+		sim.Rounds++
+	}
+
+	// time of rounds moving chunks
+	var weights float64
+	if ptr.Actions != nil {
+		for _, round := range ptr.Actions.BalancerRounds {
+			if round.TotalChunksMoved > 0 {
+				sim.MsPerRound += round.AverageExecutionTime * float64(round.Rounds)
+				weights += float64(round.Rounds)
+			}
+		}
+	}
+	if weights > 0 {
+		sim.MsPerRound /= weights
+	} else if ptr.Changes != nil {
+		sim.MsPerRound = float64(ptr.Changes.MigrationStats.P50)
+	}
+	if sim.MsPerRound > 0 {
+		sim.ETA = time.Duration(float64(sim.Rounds) * (sim.MsPerRound*float64(time.Millisecond) + float64(SHORT_ROUND_INTERVAL)))
+	}
+	sort.SliceStable(sim.Collections, func(i, j int) bool {
+		return sim.Collections[i].Migrations > sim.Collections[j].Migrations
+	})
+	return &sim, nil
+}
+
+// GetAffected returns collections having migrations or chunks blocked on the draining shard
+func (ptr *Simulation) GetAffected() []CollectionSimulation {
+	affected := []CollectionSimulation{}
+	for _, cs := range ptr.Collections {
+		if cs.Migrations > 0 || cs.Blocked > 0 {
+			affected = append(affected, cs)
+		}
+	}
+	return affected
+}
+
+// GetETA returns estimated time to reach balance, empty if no historical migration times
+func (ptr *Simulation) GetETA() string {
+	if ptr.MsPerRound == 0 {
+		return ""
+	}
+	return gox.GetDurationFromSeconds(ptr.ETA.Seconds())
+}
+
+// String returns a report of the simulation
+func (ptr *Simulation) String() string {
+	lines := []string{}
+	if ptr.Add > 0 {
+		lines = append(lines, fmt.Sprintf("Simulated adding %d shards", ptr.Add))
+	}
+	if ptr.Drain != "" {
+		lines = append(lines, fmt.Sprintf("Simulated draining shard %v", ptr.Drain))
+	}
+	lines = append(lines, fmt.Sprintf("Migrations: %d in %d balancer rounds, balanced by %v", ptr.Migrations, ptr.Rounds, ptr.Sizing))
+	if ptr.Unsized > 0 {
+		lines = append(lines, fmt.Sprintf("%d collections without data sizes were not simulated, connect through a mongos", ptr.Unsized))
+	}
+	if eta := ptr.GetETA(); eta != "" {
+		lines = append(lines, fmt.Sprintf("Estimated time to reach balance: %v (%.0f ms per round)", eta, ptr.MsPerRound))
+	} else {
+		lines = append(lines, "Estimated time to reach balance: unknown, no historical migrations found")
+	}
+	lines = append(lines, "", fmt.Sprintf("%-40v %10v  %v", "Namespace", "Migrations", "Chunks by shards after balancing"))
+	for _, cs := range ptr.GetAffected() {
+		shards := []string{}
+		for _, name := range ptr.Shards {
+			shards = append(shards, fmt.Sprintf("%v: %d", name, cs.After[name]))
+		}
+		str := fmt.Sprintf("%-40v %10d  %v", GetUserNamespace(cs.NS), cs.Migrations, strings.Join(shards, ", "))
+		if cs.Blocked > 0 {
+			str += fmt.Sprintf(" (%d chunks blocked by noBalance)", cs.Blocked)
+		}
+		lines = append(lines, str)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// GetSimulateTemplate returns HTML of the balancer simulator
+func GetSimulateTemplate() (*template.Template, error) {
+	html := GetContentHTML()
+	html += SimulateHTML
+	html += "</body></html>"
+	return template.New("bond").Funcs(infoFuncMap()).Parse(html)
+}
+
+const (
+	// balancer simulator
+	SimulateHTML = `<div style='float: left; clear: left;'>
+		<table width=400px><caption>Balancer Simulator</caption><tr><th>Option</th><th>Value</th>
+			<tr><td align='left' class='rowtitle'>Add Shards</td><td align='center' class='break'>
+				<input type='number' min='0' max='100' size='6' value='{{.Add}}' onchange="setQueryParam('add', this.value)"/></td></tr>
+			<tr><td align='left' class='rowtitle'>Drain Shard</td><td align='center' class='break'>
+				<select style="margin: 0px 0px; padding: 0px 0px; font-size: 1em" onchange="setQueryParam('drain', this.value)">
+					<option value=''>none</option>
+				{{range $name, $v := .Config.ShardsMap}}
+					<option value='{{$name}}'{{if eq $name $.Drain}} selected{{end}}>{{$name}}</option>
+				{{end}}
+				</select></td></tr>
+		{{if .Error}}
+			<tr><td align='left' class='rowtitle'>Error</td><td align='left' class='break'><span style='color: red'>{{.Error}}</span></td></tr>
+		{{else}}
+			<tr><td align='left' class='rowtitle'>Migrations</td><td align='right' class='break'>{{ numPrinter .Simulation.Migrations }}</td></tr>
+			<tr><td align='left' class='rowtitle'>Balancer Rounds</td><td align='right' class='break'>{{ numPrinter .Simulation.Rounds }}</td></tr>
+			<tr><td align='left' class='rowtitle'>Balanced by</td><td align='right' class='break'>{{ .Simulation.Sizing }}</td></tr>
+		{{if .Simulation.Unsized}}
+			<tr><td align='left' class='rowtitle'>Not Simulated</td><td align='right' class='break'>{{ numPrinter .Simulation.Unsized }} collections without data sizes, connect through a mongos {{getWarningSymbol false}}</td></tr>
+		{{end}}
+			<tr><td align='left' class='rowtitle'>Time per Round</td><td align='right' class='break'>{{ getDurationFromMilliseconds .Simulation.MsPerRound }}</td></tr>
+			<tr><td align='left' class='rowtitle'>Estimated Time to Balance</td><td align='right' class='break'>
+				{{if .Simulation.GetETA}}{{.Simulation.GetETA}}{{else}}unknown, no historical migrations{{end}}</td></tr>
+		{{end}}
+		</table></div>
+
+{{if not .Error}}
+	<div style='float: left;'>
+	<table><caption>Simulated Migrations by Collections</caption><tr><th>#</th>
+	<th>Namespace</th><th>Migrations</th>{{range $name := .Simulation.Shards}}<th>{{$name}}</th>{{end}}
+	{{range $n, $value := .Simulation.GetAffected}}
+			<tr>
+				<td align='right' class='break'>{{ add $n 1 }}</td>
+				<td align='left' class='break'>{{ getUserNamespace $value.NS }}</td>
+				<td align='right' class='break'>{{ numPrinter $value.Migrations }} {{getWarningSymbol (eq $value.Blocked 0) }}</td>
+			{{range $name := $.Simulation.Shards}}
+				<td align='right' class='break'>{{ numPrinter (index $value.Before $name) }} &rarr; {{ numPrinter (index $value.After $name) }}</td>
+			{{end}}
+			</tr>
+	{{end}}
+	</table></div>
+{{end}}`
+)
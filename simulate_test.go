@@ -0,0 +1,116 @@
+/*
+ * Copyright 2023-present Kuei-chun Chen. All rights reserved.
+ * simulate_test.go
+ */
+
+package bond
+
+import "testing"
+
+// newSimulateConfig returns a config of a collection db.coll having chunks and data sizes by shards
+func newSimulateConfig(version string, chunks map[string]int, sizes map[string]int64, noBalance bool) *ConfigDB {
+	config := &ConfigDB{CollectionsMap: map[string]ConfigCollection{}, MajorVersion: version, ShardsMap: map[string]ConfigShard{}}
+	total := 0
+	for name, n := range chunks {
+		id := name
+		config.ShardsMap[name] = ConfigShard{ID: &id, Chunks: n}
+		total += n
+	}
+	config.CollectionsMap["db.coll"] = ConfigCollection{ID: "db.coll", Chunks: total, NoBalance: noBalance,
+		Balance: CollectionBalance{ShardSizes: sizes}, shards: chunks}
+	return config
+}
+
+func TestSimulateInvalid(t *testing.T) {
+	config := newSimulateConfig("5.0", map[string]int{"shard0": 10, "shard1": 10}, nil, false)
+	tests := []struct {
+		add   int
+		drain string
+	}{
+		{-1, ""},
+		{MAX_SIMULATED_SHARDS + 1, ""},
+		{0, "shard9"},
+	}
+	for _, tc := range tests {
+		if _, err := config.Simulate(tc.add, tc.drain); err == nil {
+			t.Errorf("Simulate(%d, %q) expected an error", tc.add, tc.drain)
+		}
+	}
+	if _, err := config.Simulate(MAX_SIMULATED_SHARDS, ""); err != nil {
+		t.Errorf("Simulate(%d, \"\") = %v", MAX_SIMULATED_SHARDS, err)
+	}
+	single := newSimulateConfig("5.0", map[string]int{"shard0": 10}, nil, false)
+	if _, err := single.Simulate(0, "shard0"); err == nil {
+		t.Error("Simulate(0, shard0) of a single shard expected an error")
+	}
+}
+
+func TestSimulateChunks(t *testing.T) {
+	tests := []struct {
+		chunks map[string]int
+		add    int
+		drain  string
+		after  map[string]int
+		rounds int
+	}{
+		{map[string]int{"shard0": 12, "shard1": 0}, 0, "", map[string]int{"shard0": 6, "shard1": 6}, 6},
+		{map[string]int{"shard0": 6, "shard1": 6}, 1, "", map[string]int{"shard0": 4, "shard1": 4, "new-shard-1": 4}, 4},
+		{map[string]int{"shard0": 4, "shard1": 4}, 0, "shard1", map[string]int{"shard0": 8, "shard1": 0}, 4},
+		{map[string]int{"shard0": 5, "shard1": 5}, 0, "", map[string]int{"shard0": 5, "shard1": 5}, 0},
+	}
+	for _, tc := range tests {
+		config := newSimulateConfig("5.0", tc.chunks, nil, false)
+		sim, err := config.Simulate(tc.add, tc.drain)
+		if err != nil {
+			t.Fatalf("Simulate(%d, %q) = %v", tc.add, tc.drain, err)
+		}
+		if sim.Sizing != SIZING_CHUNKS || len(sim.Collections) != 1 {
+			t.Fatalf("Simulate(%d, %q) sizing %v of %d collections", tc.add, tc.drain, sim.Sizing, len(sim.Collections))
+		}
+		for name, n := range tc.after {
+			if sim.Collections[0].After[name] != n {
+				t.Errorf("Simulate(%d, %q) %v has %d chunks, want %d", tc.add, tc.drain, name, sim.Collections[0].After[name], n)
+			}
+		}
+		if sim.Rounds != tc.rounds {
+			t.Errorf("Simulate(%d, %q) took %d rounds, want %d", tc.add, tc.drain, sim.Rounds, tc.rounds)
+		}
+	}
+}
+
+func TestSimulateBlocked(t *testing.T) {
+	config := newSimulateConfig("5.0", map[string]int{"shard0": 4, "shard1": 4}, nil, true)
+	sim, err := config.Simulate(0, "shard1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs := sim.Collections[0]
+	if cs.Blocked != 4 || cs.Migrations != 0 || len(sim.GetAffected()) != 1 {
+		t.Errorf("blocked %d, migrations %d, affected %d, want 4, 0, 1", cs.Blocked, cs.Migrations, len(sim.GetAffected()))
+	}
+}
+
+func TestSimulateDataSize(t *testing.T) {
+	mb := int64(1024 * 1024)
+	config := newSimulateConfig("6.0", map[string]int{"shard0": 20, "shard1": 20},
+		map[string]int64{"shard0": 2000 * mb, "shard1": 0}, false)
+	sim, err := config.Simulate(0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sim.Sizing != SIZING_DATA_SIZE {
+		t.Fatalf("sizing %v, want %v", sim.Sizing, SIZING_DATA_SIZE)
+	}
+	cs := sim.Collections[0]
+	if diff := cs.sizes["shard0"] - cs.sizes["shard1"]; diff >= 3*DEFAULT_CHUNK_SIZE_MB*mb || cs.Migrations == 0 {
+		t.Errorf("data size difference %d after %d migrations", diff, cs.Migrations)
+	}
+
+	unsized := newSimulateConfig("6.0", map[string]int{"shard0": 20, "shard1": 0}, nil, false)
+	if sim, err = unsized.Simulate(1, ""); err != nil {
+		t.Fatal(err)
+	}
+	if sim.Unsized != 1 || len(sim.Collections) != 0 {
+		t.Errorf("unsized %d of %d collections, want 1 of 0", sim.Unsized, len(sim.Collections))
+	}
+}
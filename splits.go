@@ -0,0 +1,219 @@
+/*
+ * Copyright 2023-present Kuei-chun Chen. All rights reserved.
+ * splits.go
+ */
+
+package bond
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	SPLIT_BURST_THRESHOLD = 100
+	SPLIT_BURST_WINDOW    = 10 * time.Minute
+)
+
+// NamespaceSplit is number of splits of a collection on a shard within a minute
+type NamespaceSplit struct {
+	NS    string             `bson:"ns"`
+	Shard string             `bson:"shard"`
+	Time  primitive.DateTime `bson:"time"`
+	Total int                `bson:"total"`
+}
+
+// SplitBurst is a time window of a collection having splits above the threshold within SPLIT_BURST_WINDOW
+type SplitBurst struct {
+	End   primitive.DateTime `bson:"end"`
+	NS    string             `bson:"ns"`
+	Start primitive.DateTime `bson:"start"`
+	Total int                `bson:"total"`
+}
+
+// SplitRate is splits of a collection, rate is splits per hour of the analyzed time span and peak is the
+// maximum splits within SPLIT_BURST_WINDOW
+type SplitRate struct {
+	Bursts int         `bson:"bursts"`
+	NS     string      `bson:"ns"`
+	Peak   int         `bson:"peak"`
+	Rate   float64     `bson:"rate"`
+	Shards []NameValue `bson:"shards"`
+	Total  int         `bson:"total"`
+}
+
+// GetNamespaceSplits aggregates chunk splits by minute, namespace, and shard
+func (ptr *ChangeLog) GetNamespaceSplits() error {
+	log.Println("ChangeLog.GetNamespaceSplits()")
+	pipeline := bson.A{
+		bson.D{
+			{Key: "$match", Value: bson.D{
+				{Key: "what", Value: bson.D{
+					{Key: "$in", Value: bson.A{"split", "multi-split"}},
+				}},
+				{Key: "time", Value: append(GetTimeRangeFilter(ptr.since, ptr.until),
+					bson.E{Key: "$ne", Value: primitive.Null{}})},
+			}},
+		},
+		bson.D{
+			{Key: "$group", Value: bson.D{
+				{Key: "_id", Value: bson.D{
+					{Key: "minute", Value: bson.D{
+						{Key: "$dateToString", Value: bson.D{
+							{Key: "format", Value: "%Y-%m-%dT%H:%M:00.000Z"},
+							{Key: "date", Value: "$time"},
+						}},
+					}},
+					{Key: "ns", Value: "$ns"},
+					{Key: "shard", Value: bson.D{{Key: "$ifNull", Value: bson.A{"$details.owningShard", "$shard"}}}},
+				}},
+				{Key: "total", Value: bson.D{{Key: "$sum", Value: 1}}},
+			}},
+		},
+		bson.D{
+			{Key: "$project", Value: bson.D{
+				{Key: "_id", Value: 0},
+				{Key: "time", Value: bson.D{{Key: "$toDate", Value: "$_id.minute"}}},
+				{Key: "ns", Value: "$_id.ns"},
+				{Key: "shard", Value: "$_id.shard"},
+				{Key: "total", Value: 1},
+			}},
+		},
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "time", Value: 1}}}},
+	}
+	ctx := context.Background()
+	db := ptr.client.Database("config")
+	opts := options.Aggregate().SetAllowDiskUse(true)
+	cursor, err := db.Collection("changelog").Aggregate(ctx, pipeline, opts)
+	if err != nil {
+		return err
+	}
+	for cursor.Next(ctx) {
+		var doc NamespaceSplit
+		cursor.Decode(&doc)
+		ptr.NamespaceSplits = append(ptr.NamespaceSplits, doc)
+	}
+	defer cursor.Close(ctx)
+	return nil
+}
+
+// GetSplitRates ranks collections by split rates and detects bursts of splits above the split threshold,
+// a threshold of 0 disables burst detection
+func (ptr *ConfigDB) GetSplitRates() {
+	ptr.SplitBursts = nil
+	ptr.SplitRates = nil
+	if ptr.Changes == nil || len(ptr.Changes.NamespaceSplits) == 0 {
+		return
+	}
+	splits := ptr.Changes.NamespaceSplits
+	first, last := splits[0].Time.Time(), splits[len(splits)-1].Time.Time().Add(time.Minute)
+	if ptr.Since != nil {
+		first = *ptr.Since
+	}
+	if ptr.Until != nil {
+		last = *ptr.Until
+	}
+	hours := last.Sub(first).Hours()
+	if hours < 1 {
+		hours = 1
+	}
+
+	namespaces := map[string][]NamespaceSplit{}
+	shards := map[string]map[string]int{}
+	for _, split := range splits {
+		// merge shards of a minute, splits are in time order
+		list := namespaces[split.NS]
+		if n := len(list); n > 0 && list[n-1].Time == split.Time {
+			list[n-1].Total += split.Total
+		} else {
+			namespaces[split.NS] = append(list, NamespaceSplit{NS: split.NS, Time: split.Time, Total: split.Total})
+		}
+		if shards[split.NS] == nil {
+			shards[split.NS] = map[string]int{}
+		}
+		shards[split.NS][split.Shard] += split.Total
+	}
+	for ns, list := range namespaces {
+		rate := SplitRate{NS: ns}
+		for name, total := range shards[ns] {
+			rate.Shards = append(rate.Shards, NameValue{Name: name, Value: total})
+			rate.Total += total
+		}
+		sort.Slice(rate.Shards, func(i, j int) bool {
+			if rate.Shards[i].Value == rate.Shards[j].Value {
+				return rate.Shards[i].Name < rate.Shards[j].Name
+			}
+			return rate.Shards[i].Value > rate.Shards[j].Value
+		})
+		rate.Rate = float64(rate.Total) / hours
+
+		// sliding windows starting at each minute with splits, overlapping windows above threshold are a burst
+		var burst *SplitBurst
+		sum, j := 0, 0
+		for i, split := range list {
+			end := split.Time.Time().Add(SPLIT_BURST_WINDOW)
+			for ; j < len(list) && list[j].Time.Time().Before(end); j++ {
+				sum += list[j].Total
+			}
+			if sum > rate.Peak {
+				rate.Peak = sum
+			}
+			if ptr.SplitThreshold > 0 && sum >= ptr.SplitThreshold {
+				windowEnd := primitive.NewDateTimeFromTime(list[j-1].Time.Time().Add(time.Minute))
+				if burst != nil && split.Time < burst.End {
+					burst.End = windowEnd
+				} else {
+					ptr.SplitBursts = append(ptr.SplitBursts, SplitBurst{End: windowEnd, NS: ns, Start: split.Time})
+					burst = &ptr.SplitBursts[len(ptr.SplitBursts)-1]
+					rate.Bursts++
+				}
+			}
+			sum -= list[i].Total
+		}
+		ptr.SplitRates = append(ptr.SplitRates, rate)
+	}
+	for i, burst := range ptr.SplitBursts {
+		for _, split := range namespaces[burst.NS] {
+			if split.Time >= burst.Start && split.Time < burst.End {
+				ptr.SplitBursts[i].Total += split.Total
+			}
+		}
+	}
+	sort.Slice(ptr.SplitRates, func(i, j int) bool {
+		if ptr.SplitRates[i].Total == ptr.SplitRates[j].Total {
+			return ptr.SplitRates[i].NS < ptr.SplitRates[j].NS
+		}
+		return ptr.SplitRates[i].Total > ptr.SplitRates[j].Total
+	})
+	sort.Slice(ptr.SplitBursts, func(i, j int) bool {
+		if ptr.SplitBursts[i].Total == ptr.SplitBursts[j].Total {
+			return ptr.SplitBursts[i].Start < ptr.SplitBursts[j].Start
+		}
+		return ptr.SplitBursts[i].Total > ptr.SplitBursts[j].Total
+	})
+}
+
+// GetSplitRatesPage returns a page of split rates
+func GetSplitRatesPage(r *http.Request, rates []SplitRate) ([]SplitRate, *TableQuery) {
+	q := NewTableQuery(r, "splitRates", "rate", true)
+	docs := []SplitRate{}
+	for _, i := range q.Apply(len(rates), func(i int) string { return rates[i].NS },
+		map[string]func(int) interface{}{
+			"ns":     func(i int) interface{} { return rates[i].NS },
+			"total":  func(i int) interface{} { return rates[i].Total },
+			"shards": func(i int) interface{} { return len(rates[i].Shards) },
+			"rate":   func(i int) interface{} { return rates[i].Rate },
+			"peak":   func(i int) interface{} { return rates[i].Peak },
+			"bursts": func(i int) interface{} { return rates[i].Bursts },
+		}) {
+		docs = append(docs, rates[i])
+	}
+	return docs, q
+}
@@ -0,0 +1,292 @@
+/*
+ * Copyright 2023-present Kuei-chun Chen. All rights reserved.
+ * tables.go
+ */
+
+package bond
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TableQuery holds sorting, name search, and pagination of a table, parameters are prefixed by the table name
+type TableQuery struct {
+	Desc   bool
+	Name   string
+	Page   int
+	Search string
+	Sort   string
+	Start  int
+	Total  int
+
+	path   string
+	values url.Values
+}
+
+// NewTableQuery parses table parameters, e.g. colls.sort, colls.order, colls.q, and colls.page
+func NewTableQuery(r *http.Request, name string, sortBy string, desc bool) *TableQuery {
+	values := r.URL.Query()
+	q := TableQuery{Desc: desc, Name: name, Page: 1, Sort: sortBy, path: r.URL.Path, values: values}
+	if s := values.Get(name + ".sort"); s != "" {
+		q.Sort = s
+		q.Desc = values.Get(name+".order") == "desc"
+	}
+	q.Search = strings.TrimSpace(values.Get(name + ".q"))
+	if page, err := strconv.Atoi(values.Get(name + ".page")); err == nil && page > 1 {
+		q.Page = page
+	}
+	return &q
+}
+
+// Apply filters rows by name, sorts by the selected column with names as tie breaker, and returns indexes of the page
+func (q *TableQuery) Apply(n int, name func(int) string, columns map[string]func(int) interface{}) []int {
+	rows := []int{}
+	search := strings.ToLower(q.Search)
+	for i := 0; i < n; i++ {
+		if search == "" || strings.Contains(strings.ToLower(name(i)), search) {
+			rows = append(rows, i)
+		}
+	}
+	column := columns[q.Sort]
+	sort.SliceStable(rows, func(i, j int) bool {
+		if column != nil {
+			if c := compareValues(column(rows[i]), column(rows[j])); c != 0 {
+				return (c < 0) != q.Desc
+			}
+		}
+		return name(rows[i]) < name(rows[j])
+	})
+	q.Total = len(rows)
+	if q.Page > q.Pages() {
+		q.Page = q.Pages()
+	}
+	q.Start = (q.Page - 1) * TOP_N
+	end := q.Start + TOP_N
+	if end > len(rows) {
+		end = len(rows)
+	}
+	return rows[q.Start:end]
+}
+
+// Pages returns number of pages
+func (q *TableQuery) Pages() int {
+	if q.Total == 0 {
+		return 1
+	}
+	return (q.Total + TOP_N - 1) / TOP_N
+}
+
+// SortURL returns URL sorting by a column, it toggles the order if the column is already sorted
+func (q *TableQuery) SortURL(column string) string {
+	order := "asc"
+	if column == q.Sort && !q.Desc {
+		order = "desc"
+	}
+	return q.getURL(map[string]string{"sort": column, "order": order, "page": ""})
+}
+
+// PageURL returns URL of a page
+func (q *TableQuery) PageURL(page int) string {
+	return q.getURL(map[string]string{"page": strconv.Itoa(page)})
+}
+
+// SearchURL returns URL expecting the search string to be appended
+func (q *TableQuery) SearchURL() string {
+	str := q.getURL(map[string]string{"q": "", "page": ""})
+	if !strings.HasSuffix(str, "?") {
+		str += "&"
+	}
+	return str + url.QueryEscape(q.Name+".q") + "="
+}
+
+func (q *TableQuery) getURL(params map[string]string) string {
+	values := url.Values{}
+	for key, value := range q.values {
+		values[key] = value
+	}
+	for key, value := range params {
+		if value == "" {
+			values.Del(q.Name + "." + key)
+		} else {
+			values.Set(q.Name+"."+key, value)
+		}
+	}
+	return q.path + "?" + values.Encode()
+}
+
+// compareValues compares values of the same type
+func compareValues(a interface{}, b interface{}) int {
+	switch x := a.(type) {
+	case string:
+		return strings.Compare(x, b.(string))
+	case bool:
+		if x == b.(bool) {
+			return 0
+		} else if !x {
+			return -1
+		}
+		return 1
+	case int, int64, float64:
+		fa, _ := strconv.ParseFloat(fmt.Sprintf("%v", a), 64)
+		fb, _ := strconv.ParseFloat(fmt.Sprintf("%v", b), 64)
+		if fa < fb {
+			return -1
+		} else if fa > fb {
+			return 1
+		}
+	}
+	return 0
+}
+
+// getSortHeader returns a table header linked to sort by the column
+func getSortHeader(q *TableQuery, column string, title string) template.HTML {
+	symbol := "fa-sort"
+	if q.Sort == column && q.Desc {
+		symbol = "fa-sort-desc"
+	} else if q.Sort == column {
+		symbol = "fa-sort-asc"
+	}
+	return template.HTML(fmt.Sprintf(`<th><a href='%s'>%s <i class='fa %s'></i></a></th>`,
+		html.EscapeString(q.SortURL(column)), html.EscapeString(title), symbol))
+}
+
+// getTablePager returns the name search box and page navigation of a table
+func getTablePager(q *TableQuery) template.HTML {
+	str := fmt.Sprintf(`<div style='clear: left; margin: 0px 5px;'><input type='text' placeholder='search name' value='%s' size='16'
+		onchange="javascript:loadData('%s' + encodeURIComponent(this.value)); return false;"/>`,
+		html.EscapeString(q.Search), html.EscapeString(template.JSEscapeString(q.SearchURL())))
+	if q.Page > 1 {
+		str += fmt.Sprintf(` <a href='%s'><i class='fa fa-chevron-left'></i></a>`,
+			html.EscapeString(q.PageURL(q.Page-1)))
+	}
+	str += fmt.Sprintf(" page %d of %d", q.Page, q.Pages())
+	if q.Page < q.Pages() {
+		str += fmt.Sprintf(` <a href='%s'><i class='fa fa-chevron-right'></i></a>`,
+			html.EscapeString(q.PageURL(q.Page+1)))
+	}
+	return template.HTML(str + "</div>")
+}
+
+// GetShardsPage returns a page of shards
+func GetShardsPage(r *http.Request, shardsMap map[string]ConfigShard) ([]ConfigShard, *TableQuery) {
+	shards := []ConfigShard{}
+	for _, shard := range shardsMap {
+		shards = append(shards, shard)
+	}
+	getString := func(s *string) string {
+		if s == nil {
+			return ""
+		}
+		return *s
+	}
+	getInt := func(n *int) int {
+		if n == nil {
+			return 0
+		}
+		return *n
+	}
+	q := NewTableQuery(r, "shards", "_id", false)
+	docs := []ConfigShard{}
+	for _, i := range q.Apply(len(shards), func(i int) string { return getString(shards[i].ID) },
+		map[string]func(int) interface{}{
+			"_id":     func(i int) interface{} { return getString(shards[i].ID) },
+			"host":    func(i int) interface{} { return getString(shards[i].Host) },
+			"state":   func(i int) interface{} { return getInt(shards[i].State) },
+			"chunks":  func(i int) interface{} { return shards[i].Chunks },
+			"jumbo":   func(i int) interface{} { return shards[i].Jumbo },
+			"maxSize": func(i int) interface{} { return getInt(shards[i].MaxSize) },
+		}) {
+		docs = append(docs, shards[i])
+	}
+	return docs, q
+}
+
+// GetMongosPage returns a page of mongos instances
+func GetMongosPage(r *http.Request, mongos []ConfigMongos) ([]ConfigMongos, *TableQuery) {
+	getString := func(s *string) string {
+		if s == nil {
+			return ""
+		}
+		return *s
+	}
+	getTime := func(t *primitive.DateTime) int64 {
+		if t == nil {
+			return 0
+		}
+		return int64(*t)
+	}
+	q := NewTableQuery(r, "mongos", "ping", true)
+	docs := []ConfigMongos{}
+	for _, i := range q.Apply(len(mongos), func(i int) string { return getString(mongos[i].ID) },
+		map[string]func(int) interface{}{
+			"_id":          func(i int) interface{} { return getString(mongos[i].ID) },
+			"mongoVersion": func(i int) interface{} { return getString(mongos[i].MongoVersion) },
+			"ping":         func(i int) interface{} { return getTime(mongos[i].Ping) },
+			"up":           func(i int) interface{} { return mongos[i].Up },
+			"waiting":      func(i int) interface{} { return mongos[i].Waiting },
+			"created":      func(i int) interface{} { return getTime(mongos[i].Created) },
+		}) {
+		docs = append(docs, mongos[i])
+	}
+	return docs, q
+}
+
+// GetDatabasesPage returns a page of databases
+func GetDatabasesPage(r *http.Request, databases []ConfigDatabase) ([]ConfigDatabase, *TableQuery) {
+	q := NewTableQuery(r, "dbs", "_id", false)
+	docs := []ConfigDatabase{}
+	for _, i := range q.Apply(len(databases), func(i int) string { return databases[i].ID },
+		map[string]func(int) interface{}{
+			"_id":         func(i int) interface{} { return databases[i].ID },
+			"primary":     func(i int) interface{} { return databases[i].Primary },
+			"partitioned": func(i int) interface{} { return databases[i].Partitioned },
+		}) {
+		docs = append(docs, databases[i])
+	}
+	return docs, q
+}
+
+// GetCollectionsPage returns a page of sharded collections
+func GetCollectionsPage(r *http.Request, name string, colls []ConfigCollection) ([]ConfigCollection, *TableQuery) {
+	q := NewTableQuery(r, name, "chunks", true)
+	docs := []ConfigCollection{}
+	for _, i := range q.Apply(len(colls), func(i int) string { return colls[i].ID },
+		map[string]func(int) interface{}{
+			"_id":       func(i int) interface{} { return colls[i].ID },
+			"key":       func(i int) interface{} { return Stringify(colls[i].Key) },
+			"unique":    func(i int) interface{} { return colls[i].Unique },
+			"noBalance": func(i int) interface{} { return colls[i].NoBalance },
+			"chunks":    func(i int) interface{} { return colls[i].Chunks },
+			"balance":   func(i int) interface{} { return colls[i].Balance.Score },
+			"compliant": func(i int) interface{} { return colls[i].Compliance != nil && colls[i].Compliance.BalancerCompliant },
+		}) {
+		docs = append(docs, colls[i])
+	}
+	return docs, q
+}
+
+// GetUnshardedPage returns a page of unsharded collections
+func GetUnshardedPage(r *http.Request, colls []UnshardedCollection) ([]UnshardedCollection, *TableQuery) {
+	q := NewTableQuery(r, "unsharded", "size", true)
+	docs := []UnshardedCollection{}
+	for _, i := range q.Apply(len(colls), func(i int) string { return colls[i].NS },
+		map[string]func(int) interface{}{
+			"ns":             func(i int) interface{} { return colls[i].NS },
+			"count":          func(i int) interface{} { return colls[i].Count },
+			"size":           func(i int) interface{} { return colls[i].Size },
+			"storageSize":    func(i int) interface{} { return colls[i].StorageSize },
+			"totalIndexSize": func(i int) interface{} { return colls[i].TotalIndexSize },
+		}) {
+		docs = append(docs, colls[i])
+	}
+	return docs, q
+}
@@ -0,0 +1,72 @@
+/*
+ * Copyright 2023-present Kuei-chun Chen. All rights reserved.
+ * tables_test.go
+ */
+
+package bond
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTableQueryApply(t *testing.T) {
+	names, sizes := []string{}, []int64{}
+	for i := 0; i < 50; i++ {
+		names = append(names, fmt.Sprintf("db%02d", i))
+		sizes = append(sizes, int64(i%5))
+	}
+	tests := []struct {
+		url   string
+		first string
+		rows  int
+		total int
+		page  int
+	}{
+		{"/bond/info", "db00", TOP_N, 50, 1},
+		{"/bond/info?dbs.page=3", "db46", 4, 50, 3},
+		{"/bond/info?dbs.page=9", "db46", 4, 50, 3},
+		{"/bond/info?dbs.page=-1", "db00", TOP_N, 50, 1},
+		{"/bond/info?dbs.sort=name&dbs.order=desc", "db49", TOP_N, 50, 1},
+		{"/bond/info?dbs.sort=size&dbs.order=desc", "db04", TOP_N, 50, 1},
+		{"/bond/info?dbs.sort=size&dbs.order=asc", "db00", TOP_N, 50, 1},
+		{"/bond/info?dbs.sort=unknown", "db00", TOP_N, 50, 1},
+		{"/bond/info?dbs.q=DB1", "db10", 10, 10, 1},
+		{"/bond/info?dbs.q=none", "", 0, 0, 1},
+	}
+	for _, tc := range tests {
+		q := NewTableQuery(httptest.NewRequest("GET", tc.url, nil), "dbs", "name", false)
+		rows := q.Apply(len(names), func(i int) string { return names[i] },
+			map[string]func(int) interface{}{
+				"name": func(i int) interface{} { return names[i] },
+				"size": func(i int) interface{} { return sizes[i] },
+			})
+		first := ""
+		if len(rows) > 0 {
+			first = names[rows[0]]
+		}
+		if first != tc.first || len(rows) != tc.rows || q.Total != tc.total || q.Page != tc.page {
+			t.Errorf("%v first %q, %d rows of %d, page %d, want %q, %d rows of %d, page %d", tc.url,
+				first, len(rows), q.Total, q.Page, tc.first, tc.rows, tc.total, tc.page)
+		}
+	}
+}
+
+func TestTableQueryURL(t *testing.T) {
+	q := NewTableQuery(httptest.NewRequest("GET", "/bond/info?dbs.sort=size&dbs.page=2&since=2023-01-01", nil), "dbs", "name", false)
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{q.SortURL("size"), "/bond/info?dbs.order=desc&dbs.sort=size&since=2023-01-01"},
+		{q.SortURL("name"), "/bond/info?dbs.order=asc&dbs.sort=name&since=2023-01-01"},
+		{q.PageURL(3), "/bond/info?dbs.page=3&dbs.sort=size&since=2023-01-01"},
+		{q.SearchURL(), "/bond/info?dbs.sort=size&since=2023-01-01&dbs.q="},
+	}
+	for _, tc := range tests {
+		if tc.url != tc.want {
+			t.Errorf("got %v, want %v", tc.url, tc.want)
+		}
+	}
+}
@@ -269,21 +269,44 @@ const headers = `<!DOCTYPE html>
     }
   </style>
   <script>
+    // keeps the time window and time zone of the current page in a URL
+    function keepWindow(url) {
+    	var current = new URLSearchParams(window.location.search);
+    	var target = new URL(url, window.location.href);
+    	['since', 'until', 'tz'].forEach(key => {
+    		if (current.has(key) && !target.searchParams.has(key)) {
+    			target.searchParams.set(key, current.get(key));
+    		}
+    	});
+    	return target.pathname + target.search;
+    }
+
     function loadData(url) {
     	var loading = document.getElementById('loading');
     	loading.style.display = 'block';
-    	fetch(url)
-        	.then(response => response.text())
-        	.then(data => {
-      			loading.style.display = 'none';
-				document.open();
-				document.write(data);
-				document.close();
-        	})
-        	.catch(error => {
-      			loading.style.display = 'none';
-        	});
+    	window.location.assign(keepWindow(url));
+    }
+
+    document.addEventListener('DOMContentLoaded', function() {
+    	document.querySelectorAll("a[href^='/bond/'], a[href^='/api/bond/']").forEach(a => {
+    		a.setAttribute('href', keepWindow(a.getAttribute('href')));
+    	});
+    });
+
+    function setQueryParam(key, value) {
+    	var params = new URLSearchParams(window.location.search);
+    	if (value == "") {
+    		params.delete(key);
+    	} else {
+    		params.set(key, value);
+    	}
+    	var query = params.toString();
+    	loadData(window.location.pathname + (query == "" ? "" : "?" + query));
     }
+
+    window.addEventListener('pageshow', function() {
+    	document.getElementById('loading').style.display = 'none';
+    });
   </script>
 </head>
 <body>
@@ -302,18 +325,27 @@ func GetContentHTML() string {
 		if(value == "") {
 			return;
 		}
-		loadData(value);
+		// chart options other than the time window, time zone and granularity are of the current chart
+		var current = new URLSearchParams(window.location.search);
+		var params = new URLSearchParams();
+		['since', 'until', 'tz', 'granularity'].forEach(key => {
+			if (current.has(key)) {
+				params.set(key, current.get(key));
+			}
+		});
+		var query = params.toString();
+		loadData(value + (query == "" ? "" : "?" + query));
 	}
 </script>
 <div align='center' style='margin: 5px 5px; padding: 5px 5px;'>
   <div style="float: left;">
-  	<button id="logs" onClick="javascript:loadData('/bond/info'); return false;"
-		class="btn"><i class="fa fa-home"> Chen's Bond</i></button>
+  	<a id="logs" href="/bond/info"
+		class="btn"><i class="fa fa-home"> Chen's Bond</i></a>
   </div>
 
   <div style="float: left;">
-    <button id="chart" onClick="javascript:loadData('/bond/charts/migration_time'); return false;" 
-        class="btn" style=""><i class="fa fa-bar-chart"></i></button>
+    <a id="chart" href="/bond/charts/migration_time"
+        class="btn"><i class="fa fa-bar-chart"></i></a>
     <select id='nextChart' style="margin: 0px 0px; padding: 0px 0px; font-size: 1em" onchange='gotoChart()'>`
 	items := []Chart{}
 	for _, chart := range charts {
@@ -333,6 +365,21 @@ func GetContentHTML() string {
 
 	html += `</select>
   </div>
+
+  <div style="float: left;">
+    <a id="events" href="/bond/events"
+        class="btn"><i class="fa fa-history"> Events</i></a>
+  </div>
+
+  <div style="float: left;">
+    <a id="simulate" href="/bond/simulate"
+        class="btn"><i class="fa fa-sliders"> Simulate</i></a>
+  </div>
+
+  <div style="float: left;">
+    <a id="merges" href="/bond/merges"
+        class="btn"><i class="fa fa-compress"> Merges</i></a>
+  </div>
 </div>
 <script>
 	function setChartType() {
@@ -0,0 +1,121 @@
+/*
+ * Copyright 2023-present Kuei-chun Chen. All rights reserved.
+ * timeseries.go
+ */
+
+package bond
+
+import (
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	BUCKETS_PREFIX = "system.buckets."
+)
+
+// GetUserNamespace returns the user-facing namespace of a time-series buckets collection, db.system.buckets.name
+// is db.name, other namespaces are unchanged
+func GetUserNamespace(ns string) string {
+	toks := strings.SplitN(ns, ".", 2)
+	if len(toks) < 2 || !strings.HasPrefix(toks[1], BUCKETS_PREFIX) {
+		return ns
+	}
+	return toks[0] + "." + strings.TrimPrefix(toks[1], BUCKETS_PREFIX)
+}
+
+// getBucketsNamespace returns the buckets namespace of a time-series collection
+func getBucketsNamespace(ns string) string {
+	toks := strings.SplitN(ns, ".", 2)
+	if len(toks) < 2 {
+		return ns
+	}
+	return toks[0] + "." + BUCKETS_PREFIX + toks[1]
+}
+
+// IsTimeseries returns true if the collection is buckets of a time-series collection, since 5.1
+func (ptr ConfigCollection) IsTimeseries() bool {
+	return ptr.TimeseriesFields != nil || GetUserNamespace(ptr.ID) != ptr.ID
+}
+
+// GetName returns the user-facing name of the collection
+func (ptr ConfigCollection) GetName() string {
+	return GetUserNamespace(ptr.ID)
+}
+
+// GetUserKey returns the shard key on user-facing fields, a time-series collection is sharded on buckets keyed
+// on meta, the metaField, and control.min.<timeField>, the earliest time of a bucket
+func (ptr ConfigCollection) GetUserKey() bson.D {
+	return ptr.GetUserFields(ptr.Key)
+}
+
+// GetUserFields maps fields of buckets to user-facing fields, e.g. a shard key or a chunk bound of a time-series
+// collection, other collections are unchanged
+func (ptr ConfigCollection) GetUserFields(doc bson.D) bson.D {
+	if ptr.TimeseriesFields == nil {
+		return doc
+	}
+	fields := ptr.TimeseriesFields
+	user := bson.D{}
+	for _, field := range doc {
+		name := field.Key
+		if name == "meta" && fields.MetaField != "" {
+			name = fields.MetaField
+		} else if strings.HasPrefix(name, "meta.") && fields.MetaField != "" {
+			name = fields.MetaField + strings.TrimPrefix(name, "meta")
+		} else if name == "control.min."+fields.TimeField {
+			name = fields.TimeField
+		}
+		user = append(user, bson.E{Key: name, Value: field.Value})
+	}
+	return user
+}
+
+// GetUserBounds returns a chunk bound of a collection on user-facing fields. A chunk of a time-series collection
+// owns buckets of which the earliest time, not every measurement, falls in the range of the time field.
+func (ptr *ConfigDB) GetUserBounds(ns string, bound bson.D) string {
+	coll, ok := ptr.CollectionsMap[ns]
+	if !ok || coll.TimeseriesFields == nil {
+		return Stringify(bound)
+	}
+	return Stringify(coll.GetUserFields(bound))
+}
+
+// getCollection returns a sharded collection by its namespace or the user-facing name of a time-series collection
+func (ptr *ConfigDB) getCollection(ns string) (ConfigCollection, bool) {
+	if coll, ok := ptr.CollectionsMap[ns]; ok {
+		return coll, ok
+	}
+	coll, ok := ptr.CollectionsMap[getBucketsNamespace(ns)]
+	return coll, ok
+}
+
+// assessTimeseriesKey adds explanations of a time-series shard key, keyed on the meta field and optionally the
+// time field as the suffix
+func assessTimeseriesKey(coll *ConfigCollection, assessment *ShardKeyAssessment) {
+	fields := coll.TimeseriesFields
+	if fields == nil || len(coll.Key) == 0 {
+		return
+	}
+	key := coll.GetUserKey()
+	leading := key[0].Key
+	if leading == fields.TimeField {
+		return // rated monotonic
+	}
+	explanation := fmt.Sprintf("Time-series buckets are distributed by the meta field %v, measurements of a meta value go to the same buckets.", leading)
+	if key[len(key)-1].Key == fields.TimeField && len(key) > 1 {
+		explanation = fmt.Sprintf("Time-series buckets are grouped by %v and split by the earliest %v of buckets.", leading, fields.TimeField)
+	} else if assessment.Rating == RATING_GOOD {
+		assessment.Rating = RATING_FAIR
+		explanation += fmt.Sprintf(" Chunks of a meta value can't be split by time, consider %v as the suffix.", fields.TimeField)
+	}
+	explanations := []string{}
+	for _, str := range assessment.Explanations {
+		if str != noIssuesExplanation {
+			explanations = append(explanations, str)
+		}
+	}
+	assessment.Explanations = append(explanations, explanation)
+}
@@ -9,6 +9,8 @@ import (
 	"fmt"
 	"regexp"
 	"strconv"
+	"strings"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 )
@@ -32,6 +34,13 @@ func Stringify(doc interface{}, opts ...string) string {
 	str = re.ReplaceAllString(str, "ObjectId($1)")
 	re = regexp.MustCompile(`{\s*"\$date":\s?("\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}\.\d{3}Z")\s*}`)
 	str = re.ReplaceAllString(str, "ISODate($1)")
+	re = regexp.MustCompile(`{\s*"\$(min|max)Key":\s?1\s*}`)
+	str = re.ReplaceAllStringFunc(str, func(s string) string {
+		if strings.Contains(s, "min") {
+			return "MinKey"
+		}
+		return "MaxKey"
+	})
 	return str
 }
 
@@ -58,3 +67,15 @@ func ToInt64(num interface{}) int64 {
 	}
 	return int64(x)
 }
+
+// GetTimeRangeFilter returns a filter of the time field within [since, until)
+func GetTimeRangeFilter(since *time.Time, until *time.Time) bson.D {
+	filter := bson.D{{Key: "$exists", Value: true}}
+	if since != nil {
+		filter = append(filter, bson.E{Key: "$gte", Value: *since})
+	}
+	if until != nil {
+		filter = append(filter, bson.E{Key: "$lt", Value: *until})
+	}
+	return filter
+}